@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,17 +16,38 @@ import (
 	"rajidou/internal/config"
 	"rajidou/internal/domain"
 	"rajidou/internal/netx"
+	"rajidou/internal/util"
 )
 
 var (
-	newLogger    = func() loggerAPI { return cli.Logger{} }
-	newNetClient = func() *netx.Client {
-		return netx.NewClient(45*time.Second, netx.RetryOptions{Retries: 3, BaseDelay: 300 * time.Millisecond, MaxDelay: 2 * time.Second})
+	newLogger = func() loggerAPI { return cli.Logger{} }
+	// bandwidth, hostLimiter, breaker and responseCache are shared by every
+	// client and configured once config is loaded; requests sent before that
+	// use the built-in defaults and no cache.
+	bandwidth     = netx.NewBandwidthLimiter()
+	hostLimiter   = netx.NewHostLimiter(netx.DefaultHostLimits())
+	breaker       = netx.NewCircuitBreaker(netx.BreakerOptions{Threshold: 5})
+	responseCache = netx.NewResponseCache()
+	newNetClient  = func() *netx.Client {
+		c := netx.NewClient(45*time.Second, netx.RetryOptions{Retries: 3, BaseDelay: 300 * time.Millisecond, MaxDelay: 2 * time.Second})
+		c.SetBandwidthLimiter(bandwidth)
+		c.SetHostLimiter(hostLimiter)
+		c.SetCircuitBreaker(breaker)
+		c.SetResponseCache(responseCache)
+		return c
 	}
 	newDownloader        = func(net *netx.Client) downloaderAPI { return domain.NewDownloader(net, 8) }
 	warmStationAreaCache = func(ctx context.Context, net *netx.Client) { domain.WarmStationAreaCache(ctx, net) }
+	// warmUp preloads shared lookups once the clients are configured; main
+	// binds it to its client.
+	warmUp               = func(ctx context.Context) {}
 	loadConfigFn         = config.Load
 	exitFn               = cli.Exit
+	removeStalePartFiles = domain.RemoveStalePartFiles
+	// stdout receives the audio of `download -o -`; useStderr then moves logs
+	// out of its way.
+	stdout    io.Writer = os.Stdout
+	useStderr           = cli.UseStderr
 )
 
 type loggerAPI interface {
@@ -35,41 +60,123 @@ type loggerAPI interface {
 
 type downloaderAPI interface {
 	ResolveToDetailURL(ctx context.Context, raw string) (string, error)
-	DownloadFromDetailURL(ctx context.Context, detailURL string, opt domain.DownloadOptions) (string, error)
+	ResolveSpan(ctx context.Context, stationID string, span domain.TimeRange) ([]string, error)
+	ListPrograms(ctx context.Context, stationID string) ([]domain.ProgramMeta, error)
+	DownloadFromDetailURL(ctx context.Context, detailURL string, opt domain.DownloadOptions) (domain.DownloadResult, error)
+	DownloadJoined(ctx context.Context, detailURLs []string, opt domain.DownloadOptions) (domain.DownloadResult, error)
 }
 
 func execute(args []string, logger loggerAPI, cfgLoader func(path string) (config.Config, error), downloader downloaderAPI) int {
-	cfgPath := cli.ParseArgs(args)
-	resolvedCfg, err := filepath.Abs(cfgPath)
+	cmd := cli.ParseCommand(args)
+	if cmd.Name == "verify" && len(cmd.Args) > 0 {
+		// An explicit directory makes verify independent of any config file.
+		dir, _ := filepath.Abs(cmd.Args[0])
+		return executeVerify(dir, logger)
+	}
+	resolvedCfg, err := filepath.Abs(cmd.ConfigPath)
 	if err != nil {
 		logger.Error(formatError(err))
 		return 1
 	}
 	cfg, err := cfgLoader(resolvedCfg)
-	if err != nil {
+	// Subcommands take their inputs from the command line, so they only need
+	// the remaining settings.
+	if err != nil && !(errors.Is(err, config.ErrNoLinks) && cmd.Name != "") {
 		logger.Error(formatError(err))
 		return 1
 	}
 	// Keep output paths deterministic for logs and downstream tooling.
 	outputDir, _ := filepath.Abs(cfg.OutputDir)
+	var links []domain.LinkSpec
+	var output string
+	switch cmd.Name {
+	case "":
+		links, err = parseConfigLinks(cfg.Links)
+	case "download":
+		links, output, err = parseDownloadArgs(cmd.Args)
+	case "archive":
+		return executeArchive(cmd.Args, cfg, outputDir, logger, downloader)
+	case "verify":
+		return executeVerify(outputDir, logger)
+	default:
+		logger.Error("unknown command: " + cmd.Name)
+		return 1
+	}
+	if err != nil {
+		logger.Error(formatError(err))
+		return 1
+	}
+	streaming := output == "-"
+	if streaming {
+		if len(links) != 1 {
+			logger.Error("streaming to stdout takes exactly one link")
+			return 1
+		}
+		useStderr()
+	} else if output != "" {
+		outputDir, _ = filepath.Abs(output)
+	}
+	split, err := parseSplitOptions(cfg)
+	if err != nil {
+		logger.Error(formatError(err))
+		return 1
+	}
+	limit, schedule, err := parseBandwidth(cfg)
+	if err != nil {
+		logger.Error(formatError(err))
+		return 1
+	}
+	bandwidth.SetLimit(limit, schedule)
+	hostLimiter.SetLimits(hostLimits(cfg))
+	breaker.SetOptions(netx.BreakerOptions{Threshold: cfg.BreakerThreshold, Cooldown: cfg.BreakerCooldown})
+	breaker.OnStateChange(func(host string, state netx.BreakerState, until time.Time) {
+		logBreakerState(logger, host, state, until)
+	})
+	if cfg.HTTPCacheDir != "" {
+		cacheDir, _ := filepath.Abs(cfg.HTTPCacheDir)
+		responseCache.SetDir(cacheDir, cfg.HTTPCacheTTL)
+	}
+	warmUp(context.Background())
+	archive, err := loadArchive(cfg)
+	if err != nil {
+		logger.Error(formatError(err))
+		return 1
+	}
+	// Part files can only be leftovers here because no download has started yet.
+	removed, err := removeStalePartFiles(outputDir)
+	if err != nil {
+		logger.Warn("Cannot clean up part files: " + formatError(err))
+	}
+	for _, p := range removed {
+		logger.Warn("Removed incomplete file from earlier run: " + p)
+	}
 
 	success := 0
+	skipped := 0
 	type failItem struct{ inputURL, reason string }
 	fails := make([]failItem, 0)
+	type reportItem struct {
+		index  int
+		result domain.DownloadResult
+	}
+	reports := make([]reportItem, 0, len(links))
 	var mu sync.Mutex
 
 	type task struct {
 		index int
-		url   string
+		link  domain.LinkSpec
 	}
 	jobs := cfg.Jobs
 	// Bound worker count to a valid range so scheduling and channel lifecycles stay predictable.
-	if jobs > len(cfg.Links) {
-		jobs = len(cfg.Links)
+	if jobs > len(links) {
+		jobs = len(links)
 	}
 	if jobs < 1 {
 		jobs = 1
 	}
+	// One pool for every job keeps the connection count bounded however many
+	// jobs run.
+	pool := domain.NewFetchPool(cfg.MaxConnections)
 	taskCh := make(chan task)
 	var wg sync.WaitGroup
 	for w := 0; w < jobs; w++ {
@@ -78,55 +185,135 @@ func execute(args []string, logger loggerAPI, cfgLoader func(path string) (confi
 			defer wg.Done()
 			for t := range taskCh {
 				progress := cli.NewDownloadProgress(fmt.Sprintf("segments[%d]", t.index+1))
-				// Use a per-item timeout so one stalled URL does not block the whole run.
-				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-				logger.Info("Input: " + t.url)
-				detailURL, err := downloader.ResolveToDetailURL(ctx, t.url)
+				// Give up on an item that stops making progress so one stalled
+				// URL does not block the whole run; slow items keep going.
+				ctx, touch, cancel := stallContext(cfg.StallTimeout)
+				input := t.link.String()
+				logger.Info("Input: " + input)
+				detailURLs, err := resolveLink(ctx, downloader, t.link)
 				if err != nil {
+					err = stallCause(ctx, err)
 					// Release timer resources on all early returns.
 					cancel()
 					progress.Stop()
 					msg := formatError(err)
 					mu.Lock()
-					fails = append(fails, failItem{inputURL: t.url, reason: msg})
+					fails = append(fails, failItem{inputURL: input, reason: msg})
 					mu.Unlock()
-					logger.Failure(t.url + " -> " + msg)
+					logger.Failure(input + " -> " + msg)
 					continue
 				}
-				logger.Info("Resolved detail: " + detailURL)
+				for _, u := range detailURLs {
+					logger.Info("Resolved detail: " + u)
+				}
 				onProgress := func(done, total int) {
+					touch()
 					progress.Update(done, total)
 				}
-				outPath, err := downloader.DownloadFromDetailURL(ctx, detailURL, domain.DownloadOptions{
-					OutputDir:  outputDir,
-					AreaID:     cfg.AreaID,
-					OnProgress: onProgress,
-				})
+				opt := domain.DownloadOptions{
+					OutputDir:             outputDir,
+					AreaID:                cfg.AreaID,
+					OnProgress:            onProgress,
+					WriteInfoJSON:         cfg.WriteInfoJSON,
+					WriteNFO:              cfg.WriteNFO,
+					Archive:               archive,
+					CompletenessTolerance: cfg.CompletenessTolerance,
+					FailIncomplete:        cfg.IncompleteAction == "fail",
+					TrimPadding:           cfg.TrimPadding,
+					Range:                 t.link.Range,
+					Split:                 split,
+					BestEffort:            cfg.BestEffort,
+					SegmentRetry:          domain.SegmentRetry{Attempts: cfg.SegmentRetries, Delay: cfg.SegmentRetryDelay},
+					SongList:              cfg.SongList,
+					Pool:                  pool,
+					Concurrency:           domain.ConcurrencyLimits{Min: cfg.MinConcurrency, Max: cfg.MaxConcurrency},
+					OnConcurrency:         progress.SetWorkers,
+				}
+				if streaming {
+					opt.Output = stdout
+				}
+				var result domain.DownloadResult
+				if len(detailURLs) == 1 {
+					result, err = downloader.DownloadFromDetailURL(ctx, detailURLs[0], opt)
+				} else {
+					result, err = downloader.DownloadJoined(ctx, detailURLs, opt)
+				}
+				err = stallCause(ctx, err)
 				cancel()
 				progress.Stop()
+				if errors.Is(err, domain.ErrAlreadyArchived) {
+					mu.Lock()
+					skipped++
+					mu.Unlock()
+					logger.Info("Skipped (already archived): " + input)
+					continue
+				}
+				if streaming && (err == nil || errors.Is(err, domain.ErrIncomplete)) {
+					// Streams have no file; report them under the stdout name.
+					result.Path = "-"
+				}
+				if result.Path != "" {
+					mu.Lock()
+					reports = append(reports, reportItem{index: t.index, result: result})
+					mu.Unlock()
+				}
 				if err != nil {
 					msg := formatError(err)
 					mu.Lock()
 					// Record failures instead of aborting so remaining inputs continue processing.
-					fails = append(fails, failItem{inputURL: t.url, reason: msg})
+					fails = append(fails, failItem{inputURL: input, reason: msg})
 					mu.Unlock()
-					logger.Failure(t.url + " -> " + msg)
+					logger.Failure(input + " -> " + msg)
 					continue
 				}
 				mu.Lock()
 				success++
 				mu.Unlock()
-				logger.Success("Downloaded: " + outPath)
+				for _, w := range result.Warnings {
+					logger.Warn(w)
+				}
+				if result.Incomplete {
+					logger.Warn(fmt.Sprintf("Incomplete: %s is short by %s", result.Path, result.Shortfall()))
+				}
+				if streaming {
+					logger.Success("Streamed to stdout: " + input)
+					continue
+				}
+				if len(result.Parts) > 0 {
+					for _, p := range result.Parts {
+						logger.Success("Downloaded part: " + p)
+					}
+					continue
+				}
+				logger.Success("Downloaded: " + result.Path)
 			}
 		}()
 	}
-	for i, inputURL := range cfg.Links {
-		taskCh <- task{index: i, url: inputURL}
+	for i, link := range links {
+		taskCh <- task{index: i, link: link}
 	}
 	close(taskCh)
 	wg.Wait()
 
-	logger.Info(fmt.Sprintf("Completed. success=%d failed=%d", success, len(fails)))
+	sort.Slice(reports, func(i, j int) bool { return reports[i].index < reports[j].index })
+	for _, r := range reports {
+		line := fmt.Sprintf("Report: %s duration=%s expected=%s", r.result.Path, r.result.Actual, r.result.Expected)
+		if len(r.result.Gaps) > 0 {
+			line += fmt.Sprintf(" gaps=%d silence=%s", len(r.result.Gaps), r.result.GapDuration())
+		}
+		if r.result.Incomplete {
+			line += fmt.Sprintf(" short=%s", r.result.Shortfall())
+		}
+		if r.result.Incomplete || len(r.result.Gaps) > 0 {
+			logger.Warn(line)
+		} else {
+			logger.Info(line)
+		}
+		for _, g := range r.result.Gaps {
+			logger.Warn(fmt.Sprintf("  gap at %s (%.1fs): %s", g.Start.In(util.Tokyo).Format("15:04:05"), g.Seconds, g.Reason))
+		}
+	}
+	logger.Info(fmt.Sprintf("Completed. success=%d skipped=%d failed=%d", success, skipped, len(fails)))
 	if len(fails) > 0 {
 		for _, f := range fails {
 			logger.Warn("Failure detail: " + f.inputURL + " :: " + f.reason)
@@ -136,15 +323,265 @@ func execute(args []string, logger loggerAPI, cfgLoader func(path string) (confi
 	return 0
 }
 
+// resolveLink returns the detail URLs of every program link selects: the
+// programs of a station span, or each resolved URL of a link or link group.
+func resolveLink(ctx context.Context, downloader downloaderAPI, link domain.LinkSpec) ([]string, error) {
+	if link.StationID != "" {
+		return downloader.ResolveSpan(ctx, link.StationID, link.Span)
+	}
+	urls := append([]string{link.URL}, link.Join...)
+	out := make([]string, 0, len(urls))
+	for _, u := range urls {
+		detailURL, err := downloader.ResolveToDetailURL(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, detailURL)
+	}
+	return out, nil
+}
+
+// parseConfigLinks parses the configured links; see domain.ParseLinkSpec.
+func parseConfigLinks(raw []string) ([]domain.LinkSpec, error) {
+	links := make([]domain.LinkSpec, 0, len(raw))
+	for _, r := range raw {
+		l, err := domain.ParseLinkSpec(r)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, nil
+}
+
+// parseDownloadArgs parses `download <url>... [--range <from>..<until>]
+// [-o <dir>|-]`. The range applies to every URL. The returned output is the
+// -o value: a directory replacing outputDir, "-" for stdout, or empty.
+func parseDownloadArgs(args []string) ([]domain.LinkSpec, string, error) {
+	var rng domain.RangeSpec
+	var urls []string
+	var output string
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "--range" && i+1 < len(args):
+			i++
+			var err error
+			if rng, err = domain.ParseRangeSpec(args[i]); err != nil {
+				return nil, "", err
+			}
+		case strings.HasPrefix(a, "--range="):
+			var err error
+			if rng, err = domain.ParseRangeSpec(strings.TrimPrefix(a, "--range=")); err != nil {
+				return nil, "", err
+			}
+		case (a == "-o" || a == "--output") && i+1 < len(args):
+			i++
+			output = args[i]
+		case strings.HasPrefix(a, "--output="):
+			output = strings.TrimPrefix(a, "--output=")
+		case strings.HasPrefix(a, "-"):
+			return nil, "", fmt.Errorf("unknown download option: %s", a)
+		default:
+			urls = append(urls, a)
+		}
+	}
+	if len(urls) == 0 {
+		return nil, "", errors.New("usage: rajidou download <url>... [--range <from>..<until>] [-o <dir>|-]")
+	}
+	links := make([]domain.LinkSpec, len(urls))
+	for i, u := range urls {
+		links[i] = domain.LinkSpec{URL: u, Range: rng}
+	}
+	return links, output, nil
+}
+
+// parseSplitOptions converts the split settings of cfg.
+func parseSplitOptions(cfg config.Config) (domain.SplitOptions, error) {
+	opt := domain.SplitOptions{Every: cfg.SplitEvery}
+	for _, s := range cfg.SplitAt {
+		p, err := domain.ParseTimePoint(s)
+		if err != nil {
+			return domain.SplitOptions{}, fmt.Errorf("invalid `splitAt` entry: %w", err)
+		}
+		opt.At = append(opt.At, p)
+	}
+	return opt, nil
+}
+
+// parseBandwidth converts the bandwidth settings of cfg.
+func parseBandwidth(cfg config.Config) (int64, []netx.BandwidthWindow, error) {
+	limit, err := netx.ParseBandwidth(cfg.MaxBandwidth)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid `maxBandwidth`: %w", err)
+	}
+	schedule := make([]netx.BandwidthWindow, 0, len(cfg.BandwidthSchedule))
+	for _, w := range cfg.BandwidthSchedule {
+		bw, err := netx.ParseBandwidthWindow(w.From, w.Until, w.Limit)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid `bandwidthSchedule` entry: %w", err)
+		}
+		schedule = append(schedule, bw)
+	}
+	return limit, schedule, nil
+}
+
+// hostLimits returns the built-in host limits overlaid with those of cfg.
+func hostLimits(cfg config.Config) map[string]netx.HostLimit {
+	limits := netx.DefaultHostLimits()
+	for host, lim := range cfg.HostLimits {
+		limits[host] = netx.HostLimit{Concurrency: lim.Concurrency, Interval: lim.Interval}
+	}
+	return limits
+}
+
+// logBreakerState reports a change of host's circuit.
+func logBreakerState(logger loggerAPI, host string, state netx.BreakerState, until time.Time) {
+	switch state {
+	case netx.BreakerOpen:
+		logger.Warn(fmt.Sprintf("Circuit open for %s: failing requests fast until %s", host, until.Format("15:04:05")))
+	case netx.BreakerHalfOpen:
+		logger.Info(fmt.Sprintf("Circuit half-open for %s: probing with one request", host))
+	default:
+		logger.Info(fmt.Sprintf("Circuit closed for %s: requests resumed", host))
+	}
+}
+
+// loadArchive opens the configured download archive, or returns nil when
+// archiving is disabled.
+func loadArchive(cfg config.Config) (*domain.DownloadArchive, error) {
+	if cfg.DownloadArchive == "" {
+		return nil, nil
+	}
+	path, err := filepath.Abs(cfg.DownloadArchive)
+	if err != nil {
+		return nil, err
+	}
+	return domain.LoadDownloadArchive(path)
+}
+
+// executeArchive runs `archive import [dir]`, seeding the download archive from
+// the downloads in dir (the configured output directory by default). Audio
+// files without sidecar or manifest entry are looked up in the schedules of
+// the stations in the manifest and in the configured links.
+func executeArchive(args []string, cfg config.Config, outputDir string, logger loggerAPI, downloader downloaderAPI) int {
+	if len(args) == 0 || args[0] != "import" {
+		logger.Error("usage: rajidou archive import [dir]")
+		return 1
+	}
+	archive, err := loadArchive(cfg)
+	if err != nil {
+		logger.Error(formatError(err))
+		return 1
+	}
+	if archive == nil {
+		logger.Error("config must set `downloadArchive` to import into")
+		return 1
+	}
+	dir := outputDir
+	if len(args) > 1 {
+		dir, _ = filepath.Abs(args[1])
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	schedule := func(stationID string) ([]domain.ProgramMeta, error) {
+		return downloader.ListPrograms(ctx, stationID)
+	}
+	res, err := domain.ImportArchiveFromDir(archive, dir, linkStations(cfg.Links), schedule)
+	if err != nil {
+		logger.Error(formatError(err))
+		return 1
+	}
+	for _, name := range res.Unmatched {
+		logger.Warn("Cannot identify the program of " + name)
+	}
+	logger.Success(fmt.Sprintf("Imported %d program(s) from %s", res.Added, dir))
+	return 0
+}
+
+// linkStations returns the stations that links name directly, by detail URL
+// or station span; other links would need resolving and are skipped.
+func linkStations(links []string) []string {
+	var out []string
+	for _, raw := range links {
+		l, err := domain.ParseLinkSpec(raw)
+		if err != nil {
+			continue
+		}
+		if l.StationID != "" {
+			out = append(out, l.StationID)
+		}
+		for _, u := range append([]string{l.URL}, l.Join...) {
+			if ref, err := domain.ExtractDetailFromDetailURL(u); err == nil {
+				out = append(out, ref.StationID)
+			}
+		}
+	}
+	return out
+}
+
+// executeVerify re-checks every manifest entry in dir and returns 2 when any
+// file is missing, modified, truncated, or corrupt.
+func executeVerify(dir string, logger loggerAPI) int {
+	results, err := domain.VerifyDir(dir)
+	if err != nil {
+		logger.Error(formatError(err))
+		return 1
+	}
+	bad := 0
+	for _, r := range results {
+		if r.Status == domain.VerifyOK {
+			logger.Success("Verified: " + r.Entry.File)
+			continue
+		}
+		bad++
+		msg := fmt.Sprintf("%s: %s", r.Status, r.Entry.File)
+		if r.Detail != "" {
+			msg += " (" + r.Detail + ")"
+		}
+		logger.Failure(msg)
+	}
+	logger.Info(fmt.Sprintf("Verify completed. ok=%d bad=%d", len(results)-bad, bad))
+	if bad > 0 {
+		return 2
+	}
+	return 0
+}
+
 func main() {
 	logger := newLogger()
 	net := newNetClient()
 	downloader := newDownloader(net)
-	warmStationAreaCache(context.Background(), net)
+	// The warm-up waits for execute so it can use the response cache.
+	warmUp = func(ctx context.Context) { warmStationAreaCache(ctx, net) }
 	exitCode := execute(os.Args[1:], logger, loadConfigFn, downloader)
 	exitFn(exitCode)
 }
 
+// errStalled is the cancellation cause of an item that made no progress.
+var errStalled = errors.New("stalled")
+
+// stallContext returns a context that is canceled with errStalled once touch
+// has not been called for d. A zero d never cancels.
+func stallContext(d time.Duration) (context.Context, func(), context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	if d <= 0 {
+		return ctx, func() {}, func() { cancel(nil) }
+	}
+	timer := time.AfterFunc(d, func() { cancel(fmt.Errorf("%w: no progress for %s", errStalled, d)) })
+	return ctx, func() { timer.Reset(d) }, func() {
+		timer.Stop()
+		cancel(nil)
+	}
+}
+
+// stallCause replaces err with the stall that canceled ctx, if any.
+func stallCause(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); err != nil && errors.Is(cause, errStalled) {
+		return cause
+	}
+	return err
+}
+
 func formatError(err error) string {
 	if err == nil {
 		return ""
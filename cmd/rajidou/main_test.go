@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	"rajidou/internal/config"
 	"rajidou/internal/domain"
@@ -35,6 +37,27 @@ func (fakeLogger) Failure(string) {}
 type fakeDownloader struct {
 	resolveErr  error
 	downloadErr error
+	// seen receives the last download options when non-nil.
+	seen *domain.DownloadOptions
+	// joined receives the detail URLs of the last joined download when non-nil.
+	joined *[]string
+	// download runs in place of a download when non-nil.
+	download func(ctx context.Context, opt domain.DownloadOptions) error
+}
+
+func (f fakeDownloader) ResolveSpan(ctx context.Context, stationID string, span domain.TimeRange) ([]string, error) {
+	return []string{"https://radiko.jp/#!/ts/" + stationID + "/20260101000000", "https://radiko.jp/#!/ts/" + stationID + "/20260101010000"}, nil
+}
+
+func (f fakeDownloader) DownloadJoined(ctx context.Context, detailURLs []string, opt domain.DownloadOptions) (domain.DownloadResult, error) {
+	if f.joined != nil {
+		*f.joined = detailURLs
+	}
+	return f.DownloadFromDetailURL(ctx, detailURLs[0], opt)
+}
+
+func (f fakeDownloader) ListPrograms(ctx context.Context, stationID string) ([]domain.ProgramMeta, error) {
+	return nil, nil
 }
 
 func (f fakeDownloader) ResolveToDetailURL(ctx context.Context, raw string) (string, error) {
@@ -44,11 +67,19 @@ func (f fakeDownloader) ResolveToDetailURL(ctx context.Context, raw string) (str
 	return "https://radiko.jp/#!/ts/AAA/20260101000000", nil
 }
 
-func (f fakeDownloader) DownloadFromDetailURL(ctx context.Context, detailURL string, opt domain.DownloadOptions) (string, error) {
+func (f fakeDownloader) DownloadFromDetailURL(ctx context.Context, detailURL string, opt domain.DownloadOptions) (domain.DownloadResult, error) {
+	if f.seen != nil {
+		*f.seen = opt
+	}
 	if f.downloadErr != nil {
-		return "", f.downloadErr
+		return domain.DownloadResult{}, f.downloadErr
+	}
+	if f.download != nil {
+		if err := f.download(ctx, opt); err != nil {
+			return domain.DownloadResult{}, err
+		}
 	}
-	return filepath.Join(opt.OutputDir, "x.aac"), nil
+	return domain.DownloadResult{Path: filepath.Join(opt.OutputDir, "x.aac")}, nil
 }
 
 func TestExecuteConfigError(t *testing.T) {
@@ -106,6 +137,183 @@ func TestExecuteResolveFailure(t *testing.T) {
 	}
 }
 
+func TestExecuteDownloadCommandWithRange(t *testing.T) {
+	cfg := config.Config{OutputDir: t.TempDir(), Jobs: 1}
+	loader := func(path string) (config.Config, error) { return cfg, config.ErrNoLinks }
+	var seen domain.DownloadOptions
+	code := execute([]string{"download", "a", "--range", "+00:45:00..+01:10:00"}, fakeLogger{}, loader, fakeDownloader{seen: &seen})
+	if code != 0 {
+		t.Fatalf("want exit 0, got %d", code)
+	}
+	if seen.Range.IsZero() {
+		t.Fatal("range was not passed to the downloader")
+	}
+	if code := execute([]string{"download", "a", "--range", "bad"}, fakeLogger{}, loader, fakeDownloader{}); code != 1 {
+		t.Fatalf("want exit 1 for a bad range, got %d", code)
+	}
+	if code := execute(nil, fakeLogger{}, loader, fakeDownloader{}); code != 1 {
+		t.Fatalf("want exit 1 without links, got %d", code)
+	}
+}
+
+func TestExecuteDownloadCommandOutput(t *testing.T) {
+	oldStdout, oldUseStderr := stdout, useStderr
+	defer func() { stdout, useStderr = oldStdout, oldUseStderr }()
+	var buf bytes.Buffer
+	redirected := false
+	stdout, useStderr = &buf, func() { redirected = true }
+
+	cfg := config.Config{OutputDir: t.TempDir(), Jobs: 1}
+	loader := func(path string) (config.Config, error) { return cfg, config.ErrNoLinks }
+	var seen domain.DownloadOptions
+	if code := execute([]string{"download", "a", "-o", "-"}, fakeLogger{}, loader, fakeDownloader{seen: &seen}); code != 0 {
+		t.Fatalf("want exit 0, got %d", code)
+	}
+	if seen.Output != &buf || !redirected {
+		t.Fatalf("stream must go to stdout with logs on stderr: %+v %v", seen, redirected)
+	}
+	if code := execute([]string{"download", "a", "b", "-o", "-"}, fakeLogger{}, loader, fakeDownloader{}); code != 1 {
+		t.Fatalf("want exit 1 for several streamed links, got %d", code)
+	}
+	dir := t.TempDir()
+	if code := execute([]string{"download", "a", "--output=" + dir}, fakeLogger{}, loader, fakeDownloader{seen: &seen}); code != 0 {
+		t.Fatalf("want exit 0, got %d", code)
+	}
+	if seen.Output != nil || seen.OutputDir != dir {
+		t.Fatalf("-o <dir> must replace outputDir: %+v", seen)
+	}
+}
+
+func TestExecuteJoinsLinkGroupsAndSpans(t *testing.T) {
+	for _, link := range []string{"a + b", "AAA 20260101000000..20260101020000"} {
+		cfg := config.Config{Links: []string{link}, OutputDir: t.TempDir(), Jobs: 1}
+		loader := func(path string) (config.Config, error) { return cfg, nil }
+		var joined []string
+		if code := execute(nil, fakeLogger{}, loader, fakeDownloader{joined: &joined}); code != 0 {
+			t.Fatalf("%s: want exit 0, got %d", link, code)
+		}
+		if len(joined) != 2 {
+			t.Fatalf("%s: want a joined download of 2 programs, got %v", link, joined)
+		}
+	}
+}
+
+func TestExecuteGivesUpOnlyOnStalledDownloads(t *testing.T) {
+	cfg := config.Config{Links: []string{"a"}, OutputDir: t.TempDir(), Jobs: 1, StallTimeout: 50 * time.Millisecond}
+	load := func(path string) (config.Config, error) { return cfg, nil }
+	slow := fakeDownloader{download: func(ctx context.Context, opt domain.DownloadOptions) error {
+		// Longer than the stall timeout in total, but never silent for that long.
+		for i := 1; i <= 8; i++ {
+			time.Sleep(15 * time.Millisecond)
+			opt.OnProgress(i, 8)
+		}
+		return ctx.Err()
+	}}
+	if code := execute([]string{"--config", "x.yaml"}, fakeLogger{}, load, slow); code != 0 {
+		t.Fatalf("slow download must finish, got exit %d", code)
+	}
+	var got error
+	stuck := fakeDownloader{download: func(ctx context.Context, opt domain.DownloadOptions) error {
+		<-ctx.Done()
+		got = stallCause(ctx, ctx.Err())
+		return ctx.Err()
+	}}
+	if code := execute([]string{"--config", "x.yaml"}, fakeLogger{}, load, stuck); code != 2 || !errors.Is(got, errStalled) {
+		t.Fatalf("stuck download must stall, got exit %d, %v", code, got)
+	}
+}
+
+func TestExecuteRejectsInvalidSplitPoint(t *testing.T) {
+	cfg := config.Config{Links: []string{"a"}, OutputDir: t.TempDir(), Jobs: 1, SplitAt: []string{"later"}}
+	loader := func(path string) (config.Config, error) { return cfg, nil }
+	if code := execute(nil, fakeLogger{}, loader, fakeDownloader{}); code != 1 {
+		t.Fatalf("want exit 1, got %d", code)
+	}
+}
+
+func TestExecuteRejectsInvalidBandwidth(t *testing.T) {
+	cfg := config.Config{Links: []string{"a"}, OutputDir: t.TempDir(), Jobs: 1, MaxBandwidth: "fast"}
+	loader := func(path string) (config.Config, error) { return cfg, nil }
+	if code := execute(nil, fakeLogger{}, loader, fakeDownloader{}); code != 1 {
+		t.Fatalf("want exit 1, got %d", code)
+	}
+	cfg.MaxBandwidth = ""
+	cfg.BandwidthSchedule = []config.BandwidthWindow{{From: "01:00", Until: "late"}}
+	if code := execute(nil, fakeLogger{}, loader, fakeDownloader{}); code != 1 {
+		t.Fatalf("want exit 1 for a bad schedule, got %d", code)
+	}
+}
+
+func TestExecuteSkipsArchivedPrograms(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "archive.txt")
+	if err := os.WriteFile(archivePath, []byte("AAA 20260101000000\n"), 0o644); err != nil {
+		t.Fatalf("seed archive: %v", err)
+	}
+	cfg := config.Config{
+		Links:           []string{"a"},
+		OutputDir:       dir,
+		Jobs:            1,
+		DownloadArchive: archivePath,
+	}
+	code := execute([]string{"--config", "x.yaml"}, fakeLogger{}, func(path string) (config.Config, error) {
+		return cfg, nil
+	}, fakeDownloader{downloadErr: domain.ErrAlreadyArchived})
+	if code != 0 {
+		t.Fatalf("want exit 0, got %d", code)
+	}
+}
+
+func TestLinkStations(t *testing.T) {
+	got := linkStations([]string{
+		"https://radiko.jp/#!/ts/AAA/20260101000000",
+		"BBB 20260101000000..20260101030000",
+		"https://radiko.jp/#!/search/live?key=x",
+	})
+	if len(got) != 2 || got[0] != "AAA" || got[1] != "BBB" {
+		t.Fatalf("unexpected stations: %v", got)
+	}
+}
+
+func TestExecuteArchiveImport(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := domain.WriteSidecarJSON(filepath.Join(dir, "x.aac"), domain.ProgramRecord{StationID: "AAA", FT: "20260101000000"}); err != nil {
+		t.Fatalf("seed sidecar: %v", err)
+	}
+	archivePath := filepath.Join(t.TempDir(), "archive.txt")
+	cfg := config.Config{Links: []string{"a"}, OutputDir: dir, DownloadArchive: archivePath}
+	loader := func(path string) (config.Config, error) { return cfg, nil }
+	if code := execute([]string{"archive", "import"}, fakeLogger{}, loader, fakeDownloader{}); code != 0 {
+		t.Fatalf("want exit 0, got %d", code)
+	}
+	raw, _ := os.ReadFile(archivePath)
+	if string(raw) != "AAA 20260101000000\n" {
+		t.Fatalf("unexpected archive: %q", raw)
+	}
+	if code := execute([]string{"archive"}, fakeLogger{}, loader, fakeDownloader{}); code != 1 {
+		t.Fatalf("want exit 1 for missing subcommand, got %d", code)
+	}
+	if code := execute([]string{"nope"}, fakeLogger{}, loader, fakeDownloader{}); code != 1 {
+		t.Fatalf("want exit 1 for unknown command, got %d", code)
+	}
+}
+
+func TestExecuteVerifyWithoutConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := domain.RecordManifestEntry(dir, domain.ManifestEntry{File: "gone.aac", SHA256: "x", Size: 1}); err != nil {
+		t.Fatalf("seed manifest: %v", err)
+	}
+	loader := func(path string) (config.Config, error) {
+		return config.Config{}, errors.New("config must not be loaded")
+	}
+	if code := execute([]string{"verify", dir}, fakeLogger{}, loader, fakeDownloader{}); code != 2 {
+		t.Fatalf("want exit 2 for missing file, got %d", code)
+	}
+	if code := execute([]string{"verify", t.TempDir()}, fakeLogger{}, loader, fakeDownloader{}); code != 0 {
+		t.Fatalf("want exit 0 for empty manifest, got %d", code)
+	}
+}
+
 func TestExecuteInvalidConfigPath(t *testing.T) {
 	if runtime.GOOS != "windows" {
 		t.Skip("filepath.Abs invalid-path behavior differs across OS")
@@ -124,6 +332,7 @@ func TestMainUsesInjectedDependencies(t *testing.T) {
 	oldNewNetClient := newNetClient
 	oldNewDownloader := newDownloader
 	oldWarm := warmStationAreaCache
+	oldWarmUp := warmUp
 	oldLoad := loadConfigFn
 	oldExit := exitFn
 	defer func() {
@@ -132,6 +341,7 @@ func TestMainUsesInjectedDependencies(t *testing.T) {
 		newNetClient = oldNewNetClient
 		newDownloader = oldNewDownloader
 		warmStationAreaCache = oldWarm
+		warmUp = oldWarmUp
 		loadConfigFn = oldLoad
 		exitFn = oldExit
 	}()
@@ -168,6 +378,7 @@ func TestMainExitOnConfigLoadError(t *testing.T) {
 	oldNewNetClient := newNetClient
 	oldNewDownloader := newDownloader
 	oldWarm := warmStationAreaCache
+	oldWarmUp := warmUp
 	oldLoad := loadConfigFn
 	oldExit := exitFn
 	defer func() {
@@ -176,6 +387,7 @@ func TestMainExitOnConfigLoadError(t *testing.T) {
 		newNetClient = oldNewNetClient
 		newDownloader = oldNewDownloader
 		warmStationAreaCache = oldWarm
+		warmUp = oldWarmUp
 		loadConfigFn = oldLoad
 		exitFn = oldExit
 	}()
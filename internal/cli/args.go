@@ -15,6 +15,36 @@ func ParseArgs(argv []string) string {
 	return "config.yaml"
 }
 
+// Command is a parsed CLI invocation.
+//
+// Name is empty for the default run, which downloads every configured link.
+type Command struct {
+	ConfigPath string
+	Name       string
+	Args       []string
+}
+
+// ParseCommand splits argv into the config path, an optional subcommand name,
+// and the subcommand's positional arguments.
+//
+// The config flag may appear anywhere; every other argument is positional.
+func ParseCommand(argv []string) Command {
+	cmd := Command{ConfigPath: ParseArgs(argv)}
+	rest := make([]string, 0, len(argv))
+	for i := 0; i < len(argv); i++ {
+		if (argv[i] == "-c" || argv[i] == "--config") && i+1 < len(argv) {
+			i++
+			continue
+		}
+		rest = append(rest, argv[i])
+	}
+	if len(rest) > 0 {
+		cmd.Name = rest[0]
+		cmd.Args = rest[1:]
+	}
+	return cmd
+}
+
 // Exit terminates the process with the given exit code.
 func Exit(code int) {
 	os.Exit(code)
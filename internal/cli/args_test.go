@@ -36,6 +36,16 @@ func TestParseArgsMissingValueFallsBack(t *testing.T) {
 	}
 }
 
+func TestParseCommand(t *testing.T) {
+	got := ParseCommand([]string{"archive", "-c", "x.yaml", "import", "out"})
+	if got.ConfigPath != "x.yaml" || got.Name != "archive" || len(got.Args) != 2 || got.Args[1] != "out" {
+		t.Fatalf("unexpected command: %+v", got)
+	}
+	if got := ParseCommand([]string{"--config", "x.yaml"}); got.Name != "" || len(got.Args) != 0 {
+		t.Fatalf("want default command, got %+v", got)
+	}
+}
+
 func captureStdout(t *testing.T, fn func()) string {
 	t.Helper()
 	old := os.Stdout
@@ -97,6 +107,24 @@ func TestLoggerMethods(t *testing.T) {
 	}
 }
 
+func TestLoggerUseStderr(t *testing.T) {
+	oldEnabled := defaultProgressManager.enabled
+	defer func() {
+		statusToStderr = false
+		defaultProgressManager.enabled = oldEnabled
+	}()
+	UseStderr()
+	var stderr string
+	stdout := captureStdout(t, func() {
+		stderr = captureStderr(t, func() {
+			Logger{}.Info("i")
+		})
+	})
+	if stdout != "" || !strings.Contains(stderr, "[INFO] i") {
+		t.Fatalf("status must move to stderr: stdout=%q stderr=%q", stdout, stderr)
+	}
+}
+
 func TestDownloadProgressUpdateAndStop(t *testing.T) {
 	oldEnabled := defaultProgressManager.enabled
 	defaultProgressManager.enabled = true
@@ -116,6 +144,23 @@ func TestDownloadProgressUpdateAndStop(t *testing.T) {
 	}
 }
 
+func TestDownloadProgressReportsWorkers(t *testing.T) {
+	oldEnabled := defaultProgressManager.enabled
+	defaultProgressManager.enabled = true
+	defer func() { defaultProgressManager.enabled = oldEnabled }()
+
+	p := NewDownloadProgress("seg")
+	out := captureStdout(t, func() {
+		p.SetWorkers(8)
+		p.Update(1, 4)
+		p.SetWorkers(3)
+		p.Stop()
+	})
+	if !strings.Contains(out, "seg: 4/4 workers=3") {
+		t.Fatalf("missing worker count: %q", out)
+	}
+}
+
 func TestExit(t *testing.T) {
 	if os.Getenv("RAJIDOU_TEST_EXIT") == "1" {
 		Exit(7)
@@ -5,36 +5,56 @@ import (
 	"os"
 )
 
-// Logger writes human-readable status messages to stdout/stderr.
+// Logger writes human-readable status messages to stdout/stderr. After
+// UseStderr every message goes to stderr.
 type Logger struct{}
 
 // Info prints an informational message.
 func (Logger) Info(msg string) {
-	writeLog(os.Stdout, "[INFO]", msg)
+	writeLog(false, "[INFO]", msg)
 }
 
 // Warn prints a warning message.
 func (Logger) Warn(msg string) {
-	writeLog(os.Stdout, "[WARN]", msg)
+	writeLog(false, "[WARN]", msg)
 }
 
 // Error prints an error message.
 func (Logger) Error(msg string) {
-	writeLog(os.Stderr, "[ERROR]", msg)
+	writeLog(true, "[ERROR]", msg)
 }
 
 // Success prints a success message.
 func (Logger) Success(msg string) {
-	writeLog(os.Stdout, "[OK]", msg)
+	writeLog(false, "[OK]", msg)
 }
 
 // Failure prints a failed-operation message.
 func (Logger) Failure(msg string) {
-	writeLog(os.Stdout, "[FAIL]", msg)
+	writeLog(false, "[FAIL]", msg)
 }
 
-func writeLog(stream *os.File, level, msg string) {
+// UseStderr moves every status message and progress line to stderr, leaving
+// stdout free for data.
+func UseStderr() {
+	outputMu.Lock()
+	statusToStderr = true
+	outputMu.Unlock()
+	defaultProgressManager.mu.Lock()
+	defaultProgressManager.enabled = isTerminal(os.Stderr)
+	defaultProgressManager.mu.Unlock()
+}
+
+func writeLog(isError bool, level, msg string) {
 	outputMu.Lock()
 	defer outputMu.Unlock()
-	fmt.Fprintln(stream, level, msg)
+	fmt.Fprintln(statusStream(isError), level, msg)
+}
+
+// statusStream returns where a message goes; callers hold outputMu.
+func statusStream(isError bool) *os.File {
+	if isError || statusToStderr {
+		return os.Stderr
+	}
+	return os.Stdout
 }
@@ -9,6 +9,8 @@ import (
 type progressState struct {
 	done  int
 	total int
+	// workers is the last reported fetch concurrency, or 0 when unknown.
+	workers int
 }
 
 type progressManager struct {
@@ -18,8 +20,11 @@ type progressManager struct {
 	enabled bool
 }
 
+// outputMu serializes terminal output and guards statusToStderr.
 var outputMu sync.Mutex
 
+var statusToStderr bool
+
 var defaultProgressManager = &progressManager{
 	order:   make([]string, 0, 16),
 	states:  make(map[string]progressState, 16),
@@ -46,6 +51,11 @@ func (p *DownloadProgress) Update(done, total int) {
 	defaultProgressManager.update(p.label, done, total)
 }
 
+// SetWorkers records how many segment fetches the task currently runs at once.
+func (p *DownloadProgress) SetWorkers(n int) {
+	defaultProgressManager.setWorkers(p.label, n)
+}
+
 // Stop finalizes progress rendering by printing a trailing newline.
 func (p *DownloadProgress) Stop() {
 	defaultProgressManager.stop(p.label)
@@ -62,7 +72,22 @@ func (m *progressManager) update(label string, done, total int) {
 		m.order = append(m.order, label)
 		m.states[label] = progressState{}
 	}
-	m.states[label] = progressState{done: done, total: total}
+	m.states[label] = progressState{done: done, total: total, workers: m.states[label].workers}
+}
+
+func (m *progressManager) setWorkers(label string, n int) {
+	if !m.enabled {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.states[label]; !ok {
+		m.order = append(m.order, label)
+	}
+	state := m.states[label]
+	state.workers = n
+	m.states[label] = state
 }
 
 func (m *progressManager) stop(label string) {
@@ -87,7 +112,11 @@ func (m *progressManager) stop(label string) {
 	}
 	outputMu.Lock()
 	defer outputMu.Unlock()
-	fmt.Fprintf(os.Stdout, "%s: %d/%d\n", label, state.done, state.total)
+	if state.workers > 0 {
+		fmt.Fprintf(statusStream(false), "%s: %d/%d workers=%d\n", label, state.done, state.total, state.workers)
+		return
+	}
+	fmt.Fprintf(statusStream(false), "%s: %d/%d\n", label, state.done, state.total)
 }
 
 func (m *progressManager) removeLabelLocked(label string) {
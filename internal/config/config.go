@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -17,8 +19,94 @@ type Config struct {
 	AreaID string `yaml:"areaId"`
 	// Jobs controls maximum parallel downloads.
 	Jobs int `yaml:"jobs"`
+	// StallTimeout gives up on one input after this long without a merged
+	// segment, however long the whole download takes. Zero uses the default
+	// of 10 minutes; a negative value never gives up.
+	StallTimeout time.Duration `yaml:"stallTimeout"`
+	// MaxConnections caps segment fetches in flight across all jobs, which
+	// share them in turn.
+	MaxConnections int `yaml:"maxConnections"`
+	// MinConcurrency and MaxConcurrency bound how many segments one download
+	// fetches at once; the count adapts to throughput and server errors.
+	MinConcurrency int `yaml:"minConcurrency"`
+	MaxConcurrency int `yaml:"maxConcurrency"`
+	// MaxBandwidth caps download traffic across all jobs, e.g. "2MiB/s".
+	// Empty means unlimited.
+	MaxBandwidth string `yaml:"maxBandwidth"`
+	// BandwidthSchedule overrides MaxBandwidth during times of day.
+	BandwidthSchedule []BandwidthWindow `yaml:"bandwidthSchedule"`
+	// HostLimits caps requests per host, keyed by host name, "*.domain" or
+	// "*"; entries add to or replace the built-in limits for Radiko's hosts.
+	HostLimits map[string]HostLimit `yaml:"hostLimits"`
+	// BreakerThreshold is how many failed requests in a row make a host fail
+	// fast for BreakerCooldown. Zero uses the default of 5; a negative value
+	// turns the circuit breaker off.
+	BreakerThreshold int           `yaml:"breakerThreshold"`
+	BreakerCooldown  time.Duration `yaml:"breakerCooldown"`
+	// HTTPCacheDir keeps station lists, stream XML and weekly program
+	// schedules between runs. Empty disables the cache.
+	HTTPCacheDir string `yaml:"httpCacheDir"`
+	// HTTPCacheTTL is how long a cached response is used before it is
+	// revalidated with the server.
+	HTTPCacheTTL time.Duration `yaml:"httpCacheTtl"`
+	// WriteInfoJSON writes a .json program record next to each download.
+	WriteInfoJSON bool `yaml:"writeInfoJson"`
+	// WriteNFO writes a Kodi/Jellyfin-style .nfo next to each download.
+	WriteNFO bool `yaml:"writeNfo"`
+	// DownloadArchive optionally names a file recording downloaded programs;
+	// programs listed there are skipped.
+	DownloadArchive string `yaml:"downloadArchive"`
+	// CompletenessTolerance is how much shorter than the scheduled program
+	// length plus trim padding a download may be before it is flagged (e.g.
+	// "10s"). Silence filled into gaps does not count as audio.
+	CompletenessTolerance time.Duration `yaml:"completenessTolerance"`
+	// IncompleteAction is "warn" or "fail" for downloads that are too short.
+	IncompleteAction string `yaml:"incompleteAction"`
+	// TrimPadding keeps this much audio around the program boundaries instead
+	// of trimming exactly to [ft, to) (e.g. "5s").
+	TrimPadding time.Duration `yaml:"trimPadding"`
+	// SplitEvery cuts each download into parts of this length (e.g. "30m").
+	SplitEvery time.Duration `yaml:"splitEvery"`
+	// SplitAt cuts each download at these program times, written as offsets
+	// ("+01:00:00"), clock times ("22:00") or YYYYMMDDHHMMSS timestamps.
+	SplitAt []string `yaml:"splitAt"`
+	// BestEffort fills segments that cannot be fetched with silence and lists
+	// them in the report instead of failing the download.
+	BestEffort bool `yaml:"bestEffort"`
+	// SegmentRetries is how many times a failed segment is fetched again.
+	// Segments skip the HTTP client's retries, so this covers every failure,
+	// including 403/404. Zero uses the default of 2; a negative value turns
+	// segment retries off.
+	SegmentRetries int `yaml:"segmentRetries"`
+	// SegmentRetryDelay is the first backoff between segment retries.
+	SegmentRetryDelay time.Duration `yaml:"segmentRetryDelay"`
+	// SongList writes the on-air song list of each download as a .cue sheet
+	// and a tracklist and embeds it as chapters when possible.
+	SongList bool `yaml:"songList"`
 }
 
+// BandwidthWindow is one bandwidthSchedule entry: from "HH:MM" until "HH:MM"
+// local time, possibly past midnight, downloads are limited to Limit
+// ("unlimited" or a rate like maxBandwidth).
+type BandwidthWindow struct {
+	From  string `yaml:"from"`
+	Until string `yaml:"until"`
+	Limit string `yaml:"limit"`
+}
+
+// HostLimit is one hostLimits entry. Zero values disable a cap.
+type HostLimit struct {
+	// Concurrency is the most requests in flight to the host.
+	Concurrency int `yaml:"concurrency"`
+	// Interval is the least time between two requests to the host.
+	Interval time.Duration `yaml:"interval"`
+}
+
+// ErrNoLinks reports a config without links. Load returns it together with
+// an otherwise valid config, so commands that take their links from the
+// command line can still use the remaining settings.
+var ErrNoLinks = errors.New("config must contain a non-empty `links` array")
+
 // Load reads, validates, and normalizes config from a YAML file path.
 func Load(path string) (Config, error) {
 	raw, err := os.ReadFile(path)
@@ -29,9 +117,6 @@ func Load(path string) (Config, error) {
 	if err := yaml.Unmarshal(raw, &c); err != nil {
 		return Config{}, err
 	}
-	if len(c.Links) == 0 {
-		return Config{}, fmt.Errorf("config must contain a non-empty `links` array")
-	}
 	// Keep defaults centralized so callers can rely on normalized values.
 	if c.OutputDir == "" {
 		c.OutputDir = "downloads"
@@ -39,5 +124,68 @@ func Load(path string) (Config, error) {
 	if c.Jobs <= 0 {
 		c.Jobs = 2
 	}
+	if c.StallTimeout == 0 {
+		c.StallTimeout = 10 * time.Minute
+	}
+	if c.StallTimeout < 0 {
+		c.StallTimeout = 0
+	}
+	if c.MaxConnections <= 0 {
+		c.MaxConnections = 8
+	}
+	if c.MinConcurrency <= 0 {
+		c.MinConcurrency = 1
+	}
+	if c.MaxConcurrency <= 0 {
+		c.MaxConcurrency = 8
+	}
+	if c.MinConcurrency > c.MaxConcurrency {
+		return Config{}, fmt.Errorf("`minConcurrency` (%d) must not exceed `maxConcurrency` (%d)", c.MinConcurrency, c.MaxConcurrency)
+	}
+	if c.CompletenessTolerance <= 0 {
+		c.CompletenessTolerance = 10 * time.Second
+	}
+	if c.SegmentRetries == 0 {
+		c.SegmentRetries = 2
+	}
+	if c.SegmentRetries < 0 {
+		c.SegmentRetries = 0
+	}
+	if c.SegmentRetryDelay <= 0 {
+		c.SegmentRetryDelay = time.Second
+	}
+	if c.BreakerThreshold == 0 {
+		c.BreakerThreshold = 5
+	}
+	if c.BreakerThreshold < 0 {
+		c.BreakerThreshold = 0
+	}
+	if c.BreakerCooldown <= 0 {
+		c.BreakerCooldown = 30 * time.Second
+	}
+	if c.HTTPCacheTTL <= 0 {
+		c.HTTPCacheTTL = time.Hour
+	}
+	for host, lim := range c.HostLimits {
+		if lim.Concurrency < 0 || lim.Interval < 0 {
+			return Config{}, fmt.Errorf("`hostLimits` entry %q must not be negative", host)
+		}
+	}
+	if c.SplitEvery < 0 {
+		return Config{}, fmt.Errorf("`splitEvery` must not be negative")
+	}
+	if c.TrimPadding < 0 {
+		return Config{}, fmt.Errorf("`trimPadding` must not be negative")
+	}
+	switch c.IncompleteAction {
+	case "":
+		c.IncompleteAction = "warn"
+	case "warn", "fail":
+	default:
+		return Config{}, fmt.Errorf("`incompleteAction` must be \"warn\" or \"fail\", got %q", c.IncompleteAction)
+	}
+	if len(c.Links) == 0 {
+		return c, ErrNoLinks
+	}
 	return c, nil
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -31,9 +32,12 @@ func TestLoadEmptyLinks(t *testing.T) {
 	if err := os.WriteFile(p, []byte("links: []\n"), 0o644); err != nil {
 		t.Fatalf("write: %v", err)
 	}
-	_, err := Load(p)
-	if err == nil {
-		t.Fatal("expected empty links error")
+	c, err := Load(p)
+	if !errors.Is(err, ErrNoLinks) {
+		t.Fatalf("expected empty links error, got %v", err)
+	}
+	if c.OutputDir != "downloads" {
+		t.Fatalf("want normalized config alongside the error, got %+v", c)
 	}
 }
 
@@ -51,3 +55,14 @@ func TestLoadCustomJobs(t *testing.T) {
 		t.Fatalf("unexpected config: %+v", c)
 	}
 }
+
+func TestLoadInvalidIncompleteAction(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "bad-action.yaml")
+	if err := os.WriteFile(p, []byte("links:\n  - https://example.com\nincompleteAction: ignore\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Load(p); err == nil {
+		t.Fatal("expected incompleteAction error")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoadDefaultJobs(t *testing.T) {
@@ -16,7 +17,102 @@ func TestLoadDefaultJobs(t *testing.T) {
 	if err != nil {
 		t.Fatalf("load: %v", err)
 	}
-	if c.Jobs != 2 {
-		t.Fatalf("want jobs=2, got %d", c.Jobs)
+	if c.Jobs != 2 || c.MaxConnections != 8 {
+		t.Fatalf("want jobs=2 and maxConnections=8, got %d and %d", c.Jobs, c.MaxConnections)
+	}
+}
+
+func TestLoadCompletenessSettings(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "c.yaml")
+	if err := os.WriteFile(p, []byte("links:\n  - https://example.com\ncompletenessTolerance: 1m30s\nincompleteAction: fail\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	c, err := Load(p)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if c.CompletenessTolerance != 90*time.Second || c.IncompleteAction != "fail" {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+}
+
+func TestLoadSplitSettings(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "c.yaml")
+	if err := os.WriteFile(p, []byte("links:\n  - https://example.com\nsplitEvery: 30m\nsplitAt: [\"+01:00:00\", \"22:00\"]\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	c, err := Load(p)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if c.SplitEvery != 30*time.Minute || len(c.SplitAt) != 2 || c.SplitAt[1] != "22:00" {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+}
+
+func TestLoadSegmentRetrySettings(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "c.yaml")
+	if err := os.WriteFile(p, []byte("links:\n  - https://example.com\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	c, err := Load(p)
+	if err != nil || c.SegmentRetries != 2 || c.SegmentRetryDelay != time.Second {
+		t.Fatalf("unexpected defaults: %+v %v", c, err)
+	}
+	if err := os.WriteFile(p, []byte("links:\n  - https://example.com\nsegmentRetries: -1\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if c, err := Load(p); err != nil || c.SegmentRetries != 0 {
+		t.Fatalf("negative retries must disable them: %+v %v", c, err)
+	}
+}
+
+func TestLoadStallTimeout(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "c.yaml")
+	if err := os.WriteFile(p, []byte("links:\n  - https://example.com\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	c, err := Load(p)
+	if err != nil || c.StallTimeout != 10*time.Minute {
+		t.Fatalf("unexpected default: %+v %v", c, err)
+	}
+	if err := os.WriteFile(p, []byte("links:\n  - https://example.com\nstallTimeout: -1s\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if c, err := Load(p); err != nil || c.StallTimeout != 0 {
+		t.Fatalf("negative timeout must disable it: %+v %v", c, err)
+	}
+}
+
+func TestLoadConcurrencyBounds(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "c.yaml")
+	if err := os.WriteFile(p, []byte("links:\n  - https://example.com\nminConcurrency: 4\nmaxConcurrency: 2\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := Load(p); err == nil {
+		t.Fatal("want error when the floor exceeds the ceiling")
+	}
+}
+
+func TestLoadHostLimits(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "c.yaml")
+	if err := os.WriteFile(p, []byte("links:\n  - https://example.com\nhostLimits:\n  radiko.jp: {concurrency: 2, interval: 50ms}\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	c, err := Load(p)
+	if err != nil || c.HostLimits["radiko.jp"] != (HostLimit{Concurrency: 2, Interval: 50 * time.Millisecond}) {
+		t.Fatalf("unexpected config: %+v %v", c, err)
+	}
+	if err := os.WriteFile(p, []byte("links:\n  - https://example.com\nhostLimits:\n  radiko.jp: {concurrency: -1}\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := Load(p); err == nil {
+		t.Fatal("want error for a negative limit")
 	}
 }
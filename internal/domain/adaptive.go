@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Source map in this file:
+//   - adaptive segment concurrency is CLI-specific; Rajiko fetches with a
+//     fixed worker count.
+//
+// ConcurrencyLimits bounds the adaptive number of segment fetches one merge
+// runs at once. A zero Max keeps the downloader's fixed worker count.
+type ConcurrencyLimits struct {
+	Min int
+	Max int
+}
+
+// throughputGain is how much faster a round must be than the previous one
+// for the limit to grow again.
+const throughputGain = 1.05
+
+// aimdLimiter tunes the number of concurrent fetches of one merge. It adds
+// one fetch after each round of limit completed fetches whose throughput beat
+// the previous round, and halves the limit on congestion: timeouts, transport
+// failures, 429 and 5xx. After a decrease, another one waits for a round of
+// completions so one burst of failures counts once. A nil limiter never
+// blocks.
+type aimdLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	active   int
+	min, max int
+	// wake is closed and replaced whenever a fetch may start.
+	wake     chan struct{}
+	onChange func(limit int)
+
+	roundStart time.Time
+	roundBytes int64
+	roundDone  int
+	lastRate   float64
+	cooldown   int
+}
+
+// newAIMDLimiter starts at initial, clamped into limits, and reports every
+// limit change, including the first one, to onChange.
+func newAIMDLimiter(limits ConcurrencyLimits, initial int, onChange func(limit int)) *aimdLimiter {
+	l := &aimdLimiter{min: max(1, limits.Min), wake: make(chan struct{}), onChange: onChange, roundStart: time.Now()}
+	l.max = max(l.min, limits.Max)
+	l.limit = min(max(initial, l.min), l.max)
+	if onChange != nil {
+		onChange(l.limit)
+	}
+	return l
+}
+
+func (l *aimdLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		if l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *aimdLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.active--
+	l.wakeLocked()
+	l.mu.Unlock()
+}
+
+// observe feeds back one finished fetch attempt of size bytes.
+func (l *aimdLimiter) observe(size int, status int, err error) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil {
+		if isCongestion(status, err) && l.cooldown == 0 {
+			l.setLimitLocked(max(l.min, l.limit/2))
+			l.cooldown = l.limit
+			l.resetRoundLocked()
+		}
+		return
+	}
+	if l.cooldown > 0 {
+		l.cooldown--
+	}
+	l.roundBytes += int64(size)
+	l.roundDone++
+	if l.roundDone < l.limit {
+		return
+	}
+	rate := float64(l.roundBytes) / time.Since(l.roundStart).Seconds()
+	if l.lastRate == 0 || rate > l.lastRate*throughputGain {
+		l.setLimitLocked(min(l.max, l.limit+1))
+	}
+	l.lastRate = rate
+	l.resetRoundLocked()
+}
+
+func (l *aimdLimiter) setLimitLocked(n int) {
+	if n == l.limit {
+		return
+	}
+	l.limit = n
+	l.wakeLocked()
+	if l.onChange != nil {
+		l.onChange(n)
+	}
+}
+
+func (l *aimdLimiter) resetRoundLocked() {
+	l.roundStart, l.roundBytes, l.roundDone = time.Now(), 0, 0
+}
+
+func (l *aimdLimiter) wakeLocked() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// isCongestion reports whether a failed attempt suggests the server or the
+// link is overloaded: no response at all (timeouts and transport errors,
+// including 5xx/429 the HTTP client gave up retrying), 429, or 5xx.
+// Cancellation is not congestion.
+func isCongestion(status int, err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	return status == 0 || status == 429 || status >= 500
+}
@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"rajidou/internal/netx"
+)
+
+func TestAIMDLimiterHalvesOnCongestionOnce(t *testing.T) {
+	var changes []int
+	l := newAIMDLimiter(ConcurrencyLimits{Min: 1, Max: 8}, 8, func(n int) { changes = append(changes, n) })
+	busy := errors.New("HTTP 503")
+	l.observe(0, 503, busy)
+	// A burst of failures from the same round counts once.
+	l.observe(0, 503, busy)
+	if l.limit != 4 {
+		t.Fatalf("want limit 4, got %d", l.limit)
+	}
+	l.observe(0, 404, errors.New("HTTP 404"))
+	l.observe(0, 0, context.Canceled)
+	// A full round of successes ends the cooldown and, being the first
+	// measured round, grows the limit.
+	for range 4 {
+		l.observe(100, 200, nil)
+	}
+	l.observe(0, 0, errors.New("timeout"))
+	if l.limit != 2 {
+		t.Fatalf("want limit 2 after the cooldown, got %d", l.limit)
+	}
+	if len(changes) != 4 || changes[0] != 8 || changes[1] != 4 || changes[2] != 5 || changes[3] != 2 {
+		t.Fatalf("unexpected reported limits: %v", changes)
+	}
+	// A round may grow the limit by one depending on timing; ending on a
+	// congestion signal keeps the result deterministic.
+	for range 10 {
+		for range l.limit {
+			l.observe(100, 200, nil)
+		}
+		l.observe(0, 500, busy)
+	}
+	if l.limit != 1 {
+		t.Fatalf("limit must stop at the floor, got %d", l.limit)
+	}
+}
+
+func TestAIMDLimiterGrowsAfterARound(t *testing.T) {
+	l := newAIMDLimiter(ConcurrencyLimits{Min: 1, Max: 3}, 2, nil)
+	l.observe(100, 200, nil)
+	if l.limit != 2 {
+		t.Fatalf("limit must wait for a full round, got %d", l.limit)
+	}
+	l.observe(100, 200, nil)
+	if l.limit != 3 {
+		t.Fatalf("first round must grow the limit, got %d", l.limit)
+	}
+	l.lastRate = 1e18
+	for range 3 {
+		l.observe(100, 200, nil)
+	}
+	if l.limit != 3 {
+		t.Fatalf("limit must hold without a throughput gain, got %d", l.limit)
+	}
+}
+
+func TestAIMDLimiterAcquireBlocksAtLimit(t *testing.T) {
+	l := newAIMDLimiter(ConcurrencyLimits{Min: 1, Max: 1}, 1, nil)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx); err == nil {
+		t.Fatal("second fetch must wait for a slot")
+	}
+	l.release()
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatalf("released slot must be reusable: %v", err)
+	}
+}
+
+func TestDownloadAndMergeAacSegmentsReportsAdaptiveConcurrency(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testADTSFrame(4))
+	}))
+	defer s.Close()
+
+	urls := make([]string, 6)
+	for i := range urls {
+		urls[i] = s.URL + "/" + strconv.Itoa(i)
+	}
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	var reported []int
+	out, err := NewAudioDownloader(net, 8).DownloadAndMergeAacSegments(context.Background(), testSegments(urls...), t.TempDir(), "x.aac", MergeOptions{
+		Concurrency:   ConcurrencyLimits{Min: 1, Max: 2},
+		OnConcurrency: func(n int) { reported = append(reported, n) },
+	})
+	if err != nil || out.Stream.Frames != len(urls) {
+		t.Fatalf("unexpected result: %+v %v", out, err)
+	}
+	if len(reported) == 0 || reported[0] != 2 {
+		t.Fatalf("the starting limit must be clamped and reported: %v", reported)
+	}
+}
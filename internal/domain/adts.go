@@ -0,0 +1,312 @@
+package domain
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Source map in this file:
+//   - ADTS header layout follows ISO/IEC 13818-7; frame walking and junk
+//     removal are CLI-specific integrity checks with no Rajiko counterpart.
+//
+// adtsHeaderSize is the fixed ADTS header length without CRC.
+const adtsHeaderSize = 7
+
+// adtsSamplesPerFrame is the PCM sample count of one AAC raw data block.
+const adtsSamplesPerFrame = 1024
+
+var adtsSampleRates = [...]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+var adtsProfiles = [...]string{"AAC Main", "AAC LC", "AAC SSR", "AAC LTP"}
+
+// adtsHeader is the decoded fixed and variable part of one ADTS frame header.
+type adtsHeader struct {
+	profile       int
+	sampleRateIdx int
+	channelConfig int
+	length        int
+}
+
+// parseADTSHeader decodes h and reports whether it is a plausible ADTS header:
+// sync word present, layer zero, a defined sample rate, and a frame length
+// large enough to hold its own header.
+func parseADTSHeader(h []byte) (adtsHeader, bool) {
+	if len(h) < adtsHeaderSize || h[0] != 0xFF || h[1]&0xF6 != 0xF0 {
+		return adtsHeader{}, false
+	}
+	hdr := adtsHeader{
+		profile:       int(h[2] >> 6),
+		sampleRateIdx: int(h[2]>>2) & 0x0F,
+		channelConfig: int(h[2]&0x01)<<2 | int(h[3]>>6),
+		length:        adtsFrameLength(h),
+	}
+	minLen := adtsHeaderSize
+	if h[1]&0x01 == 0 {
+		// protection_absent=0 means a 16-bit CRC follows the header.
+		minLen += 2
+	}
+	if hdr.sampleRateIdx >= len(adtsSampleRates) || hdr.length < minLen {
+		return adtsHeader{}, false
+	}
+	return hdr, true
+}
+
+// sameStream reports whether h and o carry the same codec parameters.
+func (h adtsHeader) sameStream(o adtsHeader) bool {
+	return h.profile == o.profile && h.sampleRateIdx == o.sampleRateIdx && h.channelConfig == o.channelConfig
+}
+
+// adtsFrameLength returns the 13-bit frame length, which includes the header.
+func adtsFrameLength(h []byte) int {
+	return int(h[3]&0x03)<<11 | int(h[4])<<3 | int(h[5])>>5
+}
+
+// ADTSInfo summarizes an ADTS stream: codec parameters from the first valid
+// frame, the number of frames, the exact playback duration they represent,
+// and how many non-frame bytes were discarded along the way.
+type ADTSInfo struct {
+	Profile       string        `json:"profile"`
+	SampleRate    int           `json:"sampleRate"`
+	ChannelConfig int           `json:"channelConfig"`
+	Frames        int           `json:"frames"`
+	Duration      time.Duration `json:"-"`
+	DroppedBytes  int64         `json:"droppedBytes,omitempty"`
+	TrimmedFrames int           `json:"trimmedFrames,omitempty"`
+	SilentFrames  int           `json:"silentFrames,omitempty"`
+}
+
+// add records one frame, taking codec parameters from the first frame seen.
+func (i *ADTSInfo) add(h adtsHeader) {
+	if i.Frames == 0 && i.SampleRate == 0 {
+		i.Profile = adtsProfiles[h.profile]
+		i.SampleRate = adtsSampleRates[h.sampleRateIdx]
+		i.ChannelConfig = h.channelConfig
+	}
+	i.Frames++
+	i.Duration = adtsDuration(i.Frames, i.SampleRate)
+}
+
+// merge appends the totals of a later part of the same stream.
+func (i *ADTSInfo) merge(o ADTSInfo) {
+	if i.SampleRate == 0 {
+		i.Profile, i.SampleRate, i.ChannelConfig = o.Profile, o.SampleRate, o.ChannelConfig
+	}
+	i.Frames += o.Frames
+	i.DroppedBytes += o.DroppedBytes
+	i.TrimmedFrames += o.TrimmedFrames
+	i.SilentFrames += o.SilentFrames
+	i.Duration = adtsDuration(i.Frames, i.SampleRate)
+}
+
+// FrameDuration returns the playback time of one frame, or zero when the
+// sample rate is unknown.
+func (i ADTSInfo) FrameDuration() time.Duration {
+	return adtsDuration(1, i.SampleRate)
+}
+
+func adtsDuration(frames, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(frames) * adtsSamplesPerFrame * time.Second / time.Duration(sampleRate)
+}
+
+// SanitizeADTS keeps only complete, valid ADTS frames from one segment and
+// reports what it kept. Bytes between frames, such as partial frames or
+// metadata left at segment joins, are dropped. A candidate header only counts
+// when the frame it describes ends exactly at the data end or at another sync
+// word, or when it repeats the codec parameters of the previous frame; this
+// keeps stray 0xFFF patterns inside junk from being accepted.
+// The returned slice reuses data's backing array.
+func SanitizeADTS(data []byte) ([]byte, ADTSInfo) {
+	var info ADTSInfo
+	var last adtsHeader
+	out := data[:0]
+	pos := 0
+	for pos < len(data) {
+		h, ok := parseADTSHeader(data[pos:])
+		end := pos + h.length
+		if ok && end <= len(data) {
+			chained := end == len(data) || isADTSSync(data[end:])
+			if chained || (info.Frames > 0 && h.sameStream(last)) {
+				out = append(out, data[pos:end]...)
+				info.add(h)
+				last = h
+				pos = end
+				continue
+			}
+		}
+		// Resynchronize on the next byte that could start a frame.
+		next := pos + 1
+		for next < len(data) && data[next] != 0xFF {
+			next++
+		}
+		info.DroppedBytes += int64(next - pos)
+		pos = next
+	}
+	return out, info
+}
+
+// isADTSSync reports whether b starts with an ADTS sync word and layer zero.
+// Only two bytes are needed, so a frame followed by a cut-off frame still
+// passes and the cut-off frame is dropped on its own.
+func isADTSSync(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0xFF && b[1]&0xF6 == 0xF0
+}
+
+// Silent AAC-LC raw data blocks for mono and stereo, as used by hls.js
+// (src/remux/aac-helper.ts) to fill audio gaps.
+var (
+	aacSilentMono   = []byte{0x00, 0xc8, 0x00, 0x80, 0x23, 0x80}
+	aacSilentStereo = []byte{0x21, 0x00, 0x49, 0x90, 0x02, 0x19, 0x00, 0x23, 0x80}
+)
+
+// silentADTSFrames returns n silent ADTS frames with the codec parameters of
+// info, or AAC-LC 48kHz stereo when info has none. Channel layouts other
+// than mono use the stereo block.
+func silentADTSFrames(info ADTSInfo, n int) []byte {
+	profile, rateIdx, channels := 1, 3, 2
+	for i, p := range adtsProfiles {
+		if p == info.Profile {
+			profile = i
+		}
+	}
+	for i, r := range adtsSampleRates {
+		if r == info.SampleRate {
+			rateIdx = i
+		}
+	}
+	if info.ChannelConfig > 0 {
+		channels = info.ChannelConfig
+	}
+	block := aacSilentStereo
+	if channels == 1 {
+		block = aacSilentMono
+	}
+	size := adtsHeaderSize + len(block)
+	frame := []byte{
+		0xFF, 0xF1,
+		byte(profile)<<6 | byte(rateIdx)<<2 | byte(channels>>2)&0x01,
+		byte(channels&0x03)<<6 | byte(size>>11)&0x03,
+		byte(size >> 3),
+		byte(size&0x07)<<5 | 0x1F,
+		0xFC,
+	}
+	frame = append(frame, block...)
+	out := make([]byte, 0, n*size)
+	for range n {
+		out = append(out, frame...)
+	}
+	return out
+}
+
+// TimeRange is a half-open broadcast time interval [From, Until).
+type TimeRange struct {
+	From  time.Time
+	Until time.Time
+}
+
+// IsZero reports whether r is unset, meaning no restriction.
+func (r TimeRange) IsZero() bool {
+	return r.From.IsZero() && r.Until.IsZero()
+}
+
+// Contains reports whether t falls inside r. Unset bounds are open.
+func (r TimeRange) Contains(t time.Time) bool {
+	if !r.From.IsZero() && t.Before(r.From) {
+		return false
+	}
+	if !r.Until.IsZero() && !t.Before(r.Until) {
+		return false
+	}
+	return true
+}
+
+// Pad widens r by d on both sides.
+func (r TimeRange) Pad(d time.Duration) TimeRange {
+	if !r.From.IsZero() {
+		r.From = r.From.Add(-d)
+	}
+	if !r.Until.IsZero() {
+		r.Until = r.Until.Add(d)
+	}
+	return r
+}
+
+// TrimADTS keeps the frames of a sanitized segment whose start time lies in
+// window. The segment's first frame starts at start and each following frame
+// starts one frame duration later, so cuts land exactly on frame boundaries.
+// The returned slice reuses data's backing array.
+func TrimADTS(data []byte, start time.Time, window TimeRange) ([]byte, ADTSInfo) {
+	var info ADTSInfo
+	out := data[:0]
+	k := 0
+	for pos := 0; pos < len(data); k++ {
+		h, ok := parseADTSHeader(data[pos:])
+		if !ok || pos+h.length > len(data) {
+			// Input is expected to be sanitized; keep any remainder untouched.
+			out = append(out, data[pos:]...)
+			break
+		}
+		end := pos + h.length
+		// Offsets are computed from the frame index so rounding never accumulates.
+		if window.Contains(start.Add(adtsDuration(k, adtsSampleRates[h.sampleRateIdx]))) {
+			out = append(out, data[pos:end]...)
+			info.add(h)
+		} else {
+			info.TrimmedFrames++
+		}
+		pos = end
+	}
+	return out, info
+}
+
+// AnalyzeADTS walks an ADTS stream from r, skipping an optional leading ID3
+// tag, and returns its stream summary. It fails at the first byte offset where
+// a frame has no valid header or is cut off.
+func AnalyzeADTS(r io.Reader) (ADTSInfo, error) {
+	var info ADTSInfo
+	br := bufio.NewReaderSize(r, 64*1024)
+	var offset int64
+	if head, _ := br.Peek(10); len(head) == 10 {
+		if n := ParseAACPackedHeaderSize(head); n > 0 {
+			skipped, err := br.Discard(n)
+			offset += int64(skipped)
+			if err != nil {
+				return info, fmt.Errorf("truncated ID3 tag at offset %d", offset)
+			}
+		}
+	}
+	for {
+		b, err := br.Peek(adtsHeaderSize)
+		if len(b) == 0 && errors.Is(err, io.EOF) {
+			return info, nil
+		}
+		if len(b) < adtsHeaderSize {
+			return info, fmt.Errorf("truncated ADTS header at offset %d", offset)
+		}
+		if b[0] != 0xFF || b[1]&0xF0 != 0xF0 {
+			return info, fmt.Errorf("missing ADTS sync word at offset %d", offset)
+		}
+		h, ok := parseADTSHeader(b)
+		if !ok {
+			return info, fmt.Errorf("invalid ADTS header at offset %d", offset)
+		}
+		n, err := br.Discard(h.length)
+		if err != nil {
+			return info, fmt.Errorf("truncated ADTS frame at offset %d (%d/%d bytes)", offset, n, h.length)
+		}
+		offset += int64(h.length)
+		info.add(h)
+	}
+}
+
+// ScanADTSFrames walks an ADTS stream from r and returns the number of
+// complete frames. See AnalyzeADTS for the failure conditions.
+func ScanADTSFrames(r io.Reader) (int, error) {
+	info, err := AnalyzeADTS(r)
+	return info.Frames, err
+}
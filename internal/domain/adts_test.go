@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testADTSFrame builds an AAC-LC 48kHz stereo ADTS frame with a zero payload.
+func testADTSFrame(payload int) []byte {
+	return testADTSFrameFill(payload, 0)
+}
+
+// testADTSFrameFill builds an AAC-LC 48kHz stereo ADTS frame whose payload
+// bytes are all fill, so tests can tell frames apart.
+func testADTSFrameFill(payload int, fill byte) []byte {
+	size := adtsHeaderSize + payload
+	f := bytes.Repeat([]byte{fill}, size)
+	f[0] = 0xFF
+	f[1] = 0xF1
+	f[2] = 0x4C
+	f[3] = 0x80 | byte(size>>11)&0x03
+	f[4] = byte(size >> 3)
+	f[5] = byte(size&0x07)<<5 | 0x1F
+	f[6] = 0xFC
+	return f
+}
+
+func testADTSStream(frames int) []byte {
+	var b bytes.Buffer
+	for i := 0; i < frames; i++ {
+		b.Write(testADTSFrame(10 + i%3))
+	}
+	return b.Bytes()
+}
+
+func TestScanADTSFramesValid(t *testing.T) {
+	data := append([]byte{'I', 'D', '3', 0, 0, 0, 0, 0, 0, 2, 0, 0}, testADTSStream(5)...)
+	n, err := ScanADTSFrames(bytes.NewReader(data))
+	if err != nil || n != 5 {
+		t.Fatalf("want 5 frames, got %d %v", n, err)
+	}
+}
+
+func TestScanADTSFramesDetectsDamage(t *testing.T) {
+	stream := testADTSStream(3)
+	junk := append(append([]byte{}, stream[:17]...), append([]byte{0x00, 0x01}, stream[17:]...)...)
+	if _, err := ScanADTSFrames(bytes.NewReader(junk)); err == nil || !strings.Contains(err.Error(), "sync word") {
+		t.Fatalf("want sync word error, got %v", err)
+	}
+	if _, err := ScanADTSFrames(bytes.NewReader(stream[:len(stream)-2])); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Fatalf("want truncation error, got %v", err)
+	}
+}
+
+func TestSanitizeADTSDropsJunkAndCountsDuration(t *testing.T) {
+	frame := testADTSFrame(3)
+	var data []byte
+	data = append(data, 0x00, 0xFF, 0x12)
+	data = append(data, frame...)
+	data = append(data, frame...)
+	data = append(data, 'I', 'D', '3')
+	data = append(data, frame...)
+	clean, info := SanitizeADTS(data)
+	if !bytes.Equal(clean, bytes.Repeat(frame, 3)) {
+		t.Fatalf("unexpected clean data: %v", clean)
+	}
+	if info.Frames != 3 || info.DroppedBytes != 6 || info.ChannelConfig != 2 {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	// 3 frames x 1024 samples at 48kHz.
+	if info.Duration != 3*1024*time.Second/48000 {
+		t.Fatalf("unexpected duration: %s", info.Duration)
+	}
+}
+
+func TestSanitizeADTSDropsTrailingPartialFrame(t *testing.T) {
+	frame := testADTSFrame(3)
+	data := append(append(append([]byte{}, frame...), frame...), frame[:len(frame)-2]...)
+	clean, info := SanitizeADTS(data)
+	if !bytes.Equal(clean, bytes.Repeat(frame, 2)) || info.Frames != 2 || info.DroppedBytes != int64(len(frame)-2) {
+		t.Fatalf("unexpected result: %v %+v", clean, info)
+	}
+}
+
+func TestSanitizeADTSDropsStrayHeaderRunningPastEnd(t *testing.T) {
+	frame := testADTSFrame(3)
+	// A header declaring 500 bytes with only a few left in the buffer.
+	stray := testADTSFrame(500)[:adtsHeaderSize+1]
+	data := append(append([]byte{}, frame...), stray...)
+	clean, info := SanitizeADTS(data)
+	if !bytes.Equal(clean, frame) || info.Frames != 1 || info.DroppedBytes != int64(len(stray)) {
+		t.Fatalf("unexpected result: %v %+v", clean, info)
+	}
+}
+
+func TestAnalyzeADTSReportsStreamParameters(t *testing.T) {
+	info, err := AnalyzeADTS(bytes.NewReader(testADTSStream(48000 / 1024 * 2)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Profile != "AAC LC" || info.SampleRate != 48000 || info.Frames != 92 {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+}
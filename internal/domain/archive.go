@@ -0,0 +1,253 @@
+package domain
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"rajidou/internal/util"
+)
+
+// Source map in this file:
+//   - download archive is CLI-specific and mirrors yt-dlp's --download-archive:
+//     one "<station> <ft>" line per completed program.
+//
+// ErrAlreadyArchived reports that a program was skipped because the download
+// archive already lists it.
+var ErrAlreadyArchived = errors.New("program already in download archive")
+
+// DownloadArchive is an append-only record of downloaded programs keyed by
+// station and start time. A nil archive records nothing and contains nothing.
+type DownloadArchive struct {
+	path string
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+// LoadDownloadArchive reads the archive at path. A missing file yields an
+// empty archive that is created on the first Add.
+func LoadDownloadArchive(path string) (*DownloadArchive, error) {
+	a := &DownloadArchive{path: path, keys: map[string]struct{}{}}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return a, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			// Tolerate blank or hand-edited lines instead of rejecting the archive.
+			continue
+		}
+		a.keys[archiveKey(fields[0], fields[1])] = struct{}{}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func archiveKey(stationID, ft string) string {
+	return stationID + " " + ft
+}
+
+// Has reports whether the program identified by stationID and ft is archived.
+func (a *DownloadArchive) Has(stationID, ft string) bool {
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.keys[archiveKey(stationID, ft)]
+	return ok
+}
+
+// Add records a program and appends it to the archive file. Adding a program
+// that is already archived is a no-op.
+func (a *DownloadArchive) Add(stationID, ft string) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := archiveKey(stationID, ft)
+	if _, ok := a.keys[key]; ok {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(a.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, key); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	a.keys[key] = struct{}{}
+	return nil
+}
+
+// ArchiveSchedule lists the programs of a station, for recognizing audio
+// files by name.
+type ArchiveSchedule func(stationID string) ([]ProgramMeta, error)
+
+// ArchiveImport summarizes ImportArchiveFromDir.
+type ArchiveImport struct {
+	// Added counts programs newly added to the archive.
+	Added int
+	// Unmatched lists audio files whose program could not be identified.
+	Unmatched []string
+}
+
+// partNamePattern matches the part suffix added by partFileName.
+var partNamePattern = regexp.MustCompile(` - part\d+\.aac$`)
+
+// clipNamePattern matches the range suffix added by clipFileName.
+var clipNamePattern = regexp.MustCompile(` \(\d{6}-\d{6}\)\.aac$`)
+
+// ImportArchiveFromDir seeds the archive from the downloads found in dir.
+//
+// Programs are identified by their JSON sidecars, then by the manifest. Audio
+// files with neither are matched by name against the schedule of each
+// station in stations or in the manifest; this recognizes downloads made
+// before sidecars and manifests existed, while the programs are still in
+// the weekly schedule. Clips and names matching several programs are left
+// out. A nil schedule skips name matching.
+func ImportArchiveFromDir(a *DownloadArchive, dir string, stations []string, schedule ArchiveSchedule) (ArchiveImport, error) {
+	var res ArchiveImport
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return res, err
+	}
+	add := func(stationID, ft string) error {
+		if a.Has(stationID, ft) {
+			return nil
+		}
+		if err := a.Add(stationID, ft); err != nil {
+			return err
+		}
+		res.Added++
+		return nil
+	}
+	// known holds the audio files whose program is identified.
+	known := map[string]bool{}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" || strings.HasSuffix(e.Name(), JournalSuffix) {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return res, err
+		}
+		var rec ProgramRecord
+		if err := json.Unmarshal(raw, &rec); err != nil || rec.StationID == "" || rec.FT == "" {
+			// Unrelated JSON files may live in the output directory.
+			continue
+		}
+		known[rec.File] = true
+		if rec.ClipFrom != "" {
+			// Clips do not cover the whole program.
+			continue
+		}
+		if err := add(rec.StationID, rec.FT); err != nil {
+			return res, err
+		}
+		// Joined downloads list every program as a chapter.
+		for _, c := range rec.Chapters {
+			if err := add(rec.StationID, c.FT); err != nil {
+				return res, err
+			}
+		}
+	}
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		return res, err
+	}
+	stationSet := map[string]bool{}
+	for _, st := range stations {
+		stationSet[st] = true
+	}
+	for name, m := range manifest {
+		if m.StationID == "" || m.FT == "" {
+			continue
+		}
+		stationSet[m.StationID] = true
+		if known[name] {
+			continue
+		}
+		known[name] = true
+		if clipNamePattern.MatchString(name) {
+			continue
+		}
+		if err := add(m.StationID, m.FT); err != nil {
+			return res, err
+		}
+		for _, ft := range m.Joined {
+			if err := add(m.StationID, ft); err != nil {
+				return res, err
+			}
+		}
+	}
+
+	var unknown []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && filepath.Ext(name) == ".aac" && !known[name] && !clipNamePattern.MatchString(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return res, nil
+	}
+	type program struct{ stationID, ft string }
+	// byName maps a program file name to the programs it may belong to.
+	byName := map[string][]program{}
+	if schedule != nil {
+		ids := make([]string, 0, len(stationSet))
+		for st := range stationSet {
+			ids = append(ids, st)
+		}
+		sort.Strings(ids)
+		for _, st := range ids {
+			progs, err := schedule(st)
+			if err != nil {
+				return res, fmt.Errorf("list programs of %s: %w", st, err)
+			}
+			for _, p := range progs {
+				name := util.BuildProgramFileName(p.Title, p.FT)
+				byName[name] = append(byName[name], program{st, p.FT})
+			}
+		}
+	}
+	for _, name := range unknown {
+		progs := byName[partNamePattern.ReplaceAllString(name, ".aac")]
+		if len(progs) != 1 {
+			res.Unmatched = append(res.Unmatched, name)
+			continue
+		}
+		if err := add(progs[0].stationID, progs[0].ft); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
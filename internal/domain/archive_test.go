@@ -0,0 +1,132 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadArchiveAddAndReload(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "archive.txt")
+	a, err := LoadDownloadArchive(p)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if a.Has("AAA", "20260101000000") {
+		t.Fatal("empty archive should not contain entries")
+	}
+	if err := a.Add("AAA", "20260101000000"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := a.Add("AAA", "20260101000000"); err != nil {
+		t.Fatalf("re-add: %v", err)
+	}
+	raw, _ := os.ReadFile(p)
+	if string(raw) != "AAA 20260101000000\n" {
+		t.Fatalf("unexpected archive content: %q", raw)
+	}
+	b, err := LoadDownloadArchive(p)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !b.Has("AAA", "20260101000000") || b.Has("BBB", "20260101000000") {
+		t.Fatal("reloaded archive has wrong entries")
+	}
+}
+
+func TestDownloadArchiveNilIsEmpty(t *testing.T) {
+	var a *DownloadArchive
+	if a.Has("AAA", "20260101000000") {
+		t.Fatal("nil archive should be empty")
+	}
+	if err := a.Add("AAA", "20260101000000"); err != nil {
+		t.Fatalf("nil archive add should be a no-op: %v", err)
+	}
+}
+
+func TestImportArchiveFromDir(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := WriteSidecarJSON(filepath.Join(dir, "x.aac"), ProgramRecord{StationID: "AAA", FT: "20260101000000"}); err != nil {
+		t.Fatalf("seed sidecar: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.json"), []byte(`{"foo":1}`), 0o644); err != nil {
+		t.Fatalf("seed other: %v", err)
+	}
+	a, _ := LoadDownloadArchive(filepath.Join(t.TempDir(), "archive.txt"))
+	res, err := ImportArchiveFromDir(a, dir, nil, nil)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if res.Added != 1 || !a.Has("AAA", "20260101000000") {
+		t.Fatalf("unexpected import result: %+v", res)
+	}
+}
+
+func TestImportArchiveFromDirReadsJoinedManifestEntries(t *testing.T) {
+	dir := t.TempDir()
+	if err := RecordManifestEntry(dir, ManifestEntry{
+		File:      "Show - 20260101.aac",
+		StationID: "AAA",
+		FT:        "20260101200000",
+		Joined:    []string{"20260101200000", "20260101210000"},
+	}); err != nil {
+		t.Fatalf("seed manifest: %v", err)
+	}
+	a, _ := LoadDownloadArchive(filepath.Join(t.TempDir(), "archive.txt"))
+	res, err := ImportArchiveFromDir(a, dir, nil, nil)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if res.Added != 2 || !a.Has("AAA", "20260101200000") || !a.Has("AAA", "20260101210000") {
+		t.Fatalf("every joined program should be imported: %+v", res)
+	}
+}
+
+func TestImportArchiveFromDirWithoutSidecars(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"Morning - 20260101.aac",
+		"Night - 20260101 - part1.aac",
+		"Night - 20260101 - part2.aac",
+		"News - 20260101.aac",
+		"Gone - 20251201.aac",
+		"Morning - 20260101 (060000-063000).aac",
+		"Evening - 20260101.aac",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+			t.Fatalf("seed %s: %v", name, err)
+		}
+	}
+	if err := RecordManifestEntry(dir, ManifestEntry{File: "Evening - 20260101.aac", StationID: "BBB", FT: "20260101180000"}); err != nil {
+		t.Fatalf("seed manifest: %v", err)
+	}
+	schedules := map[string][]ProgramMeta{
+		"AAA": {
+			{FT: "20260101060000", Title: "Morning"},
+			{FT: "20260101230000", Title: "Night"},
+			{FT: "20260101070000", Title: "News"},
+			{FT: "20260101120000", Title: "News"},
+		},
+		"BBB": {{FT: "20260101180000", Title: "Evening"}},
+	}
+	var asked []string
+	schedule := func(st string) ([]ProgramMeta, error) {
+		asked = append(asked, st)
+		return schedules[st], nil
+	}
+	a, _ := LoadDownloadArchive(filepath.Join(t.TempDir(), "archive.txt"))
+	res, err := ImportArchiveFromDir(a, dir, []string{"AAA"}, schedule)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if res.Added != 3 || !a.Has("AAA", "20260101060000") || !a.Has("AAA", "20260101230000") || !a.Has("BBB", "20260101180000") {
+		t.Fatalf("unexpected import result: %+v", res)
+	}
+	// News airs twice that day, and Gone left the schedule.
+	if len(res.Unmatched) != 2 || res.Unmatched[0] != "Gone - 20251201.aac" || res.Unmatched[1] != "News - 20260101.aac" {
+		t.Fatalf("unexpected unmatched files: %v", res.Unmatched)
+	}
+	if len(asked) != 2 || asked[0] != "AAA" || asked[1] != "BBB" {
+		t.Fatalf("want the configured and manifest stations looked up, got %v", asked)
+	}
+}
@@ -1,12 +1,18 @@
 package domain
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"rajidou/internal/netx"
 )
@@ -40,107 +46,526 @@ func ParseAACPackedHeaderSize(data []byte) int {
 	if data[0] != 73 || data[1] != 68 || data[2] != 51 {
 		return 0
 	}
-	id3 := int(data[6])<<24 | int(data[7])<<16 | int(data[8])<<8 | int(data[9])
+	// The tag size is a synchsafe integer: 7 significant bits per byte.
+	id3 := int(data[6]&0x7F)<<21 | int(data[7]&0x7F)<<14 | int(data[8]&0x7F)<<7 | int(data[9]&0x7F)
 	return 10 + id3
 }
 
-var mergeBufferPool = sync.Pool{
-	New: func() interface{} {
-		return &bytes.Buffer{}
-	},
+// AudioResult describes a merged AAC output file.
+type AudioResult struct {
+	Path     string
+	Size     int64
+	SHA256   string
+	Segments int
+	Stream   ADTSInfo
+	// Gaps lists segments replaced by silence in best-effort mode.
+	Gaps []Gap
 }
 
-// DownloadAndMergeAacSegments downloads all segment URLs, strips optional ID3
-// headers, and writes one merged AAC file. Segment order is preserved by index
-// even when downloads complete out of order.
-func (a *AudioDownloader) DownloadAndMergeAacSegments(ctx context.Context, urls []string, outputDir, fileName string, onProgress func(done, total int)) (string, error) {
+// Gap is a segment that could not be fetched and was replaced by silence.
+type Gap struct {
+	Index   int       `json:"index"`
+	URL     string    `json:"url"`
+	Start   time.Time `json:"start"`
+	Frames  int       `json:"frames"`
+	Seconds float64   `json:"seconds"`
+	Reason  string    `json:"reason"`
+}
+
+// defaultSegmentDuration is Radiko's media segment length, assumed for gaps
+// whose chunklist entry carried no duration.
+const defaultSegmentDuration = 5 * time.Second
+
+// MergeOptions configures one segment merge.
+type MergeOptions struct {
+	OnProgress func(done, total int)
+	// Window, when set, keeps only frames that start inside it.
+	Window TimeRange
+	// Header is written before the first segment, e.g. an ID3 tag.
+	Header []byte
+	// BestEffort replaces segments that still fail after retries with
+	// silence of the same length instead of failing the merge.
+	BestEffort bool
+	// Retry is the per-segment retry budget.
+	Retry SegmentRetry
+	// Pool, when set, bounds fetches together with other merges sharing it.
+	Pool *FetchPool
+	// Concurrency, when its Max is set, lets the number of concurrent
+	// fetches adapt between its bounds, starting from the downloader's.
+	Concurrency ConcurrencyLimits
+	// OnConcurrency observes each change of the adaptive fetch limit.
+	OnConcurrency func(limit int)
+}
+
+// SegmentRetry re-fetches a failed segment. Segment fetches skip the HTTP
+// client's own retries, so every failure is retried here, including 403 and
+// 404 from a CDN edge that has not caught up yet. The zero value fetches
+// each segment once.
+type SegmentRetry struct {
+	// Attempts is the number of extra fetches after the first.
+	Attempts int
+	// Delay is the first backoff; later ones double up to 8x.
+	Delay time.Duration
+}
+
+// SegmentError is a segment that could not be fetched.
+type SegmentError struct {
+	Index int
+	URL   string
+	// Status is the final HTTP status, or 0 when no response arrived.
+	Status   int
+	Attempts int
+	Err      error
+}
+
+func (e *SegmentError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("segment %d: %v after %d attempts", e.Index, e.Err, e.Attempts)
+	}
+	return fmt.Sprintf("segment %d: %v", e.Index, e.Err)
+}
+
+func (e *SegmentError) Unwrap() error { return e.Err }
+
+// SegmentFetchError lists every segment of a merge that could not be
+// fetched, in index order.
+type SegmentFetchError struct {
+	Failed []*SegmentError
+	Total  int
+}
+
+// maxListedFailures caps how many failed segments the error message names.
+const maxListedFailures = 5
+
+func (e *SegmentFetchError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "segment fetch failed: %d of %d segments", len(e.Failed), e.Total)
+	for i, f := range e.Failed {
+		if i == maxListedFailures {
+			fmt.Fprintf(&b, "; and %d more", len(e.Failed)-i)
+			break
+		}
+		fmt.Fprintf(&b, "; %v [%s]", f, f.URL)
+	}
+	return b.String()
+}
+
+// Unwrap exposes each segment failure to errors.Is and errors.As.
+func (e *SegmentFetchError) Unwrap() []error {
+	out := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		out[i] = f
+	}
+	return out
+}
+
+type segmentResult struct {
+	idx  int
+	data []byte
+	info ADTSInfo
+	err  error
+}
+
+// DownloadAndMergeAacSegments downloads all segments, strips optional ID3
+// headers and any non-frame bytes, trims frames outside opt.Window, and
+// streams one merged AAC file to disk through a resumable part file.
+func (a *AudioDownloader) DownloadAndMergeAacSegments(ctx context.Context, segs []Segment, outputDir, fileName string, opt MergeOptions) (AudioResult, error) {
 	if err := os.MkdirAll(outputDir, 0o755); err != nil {
-		return "", err
+		return AudioResult{}, err
 	}
-	total := len(urls)
-	onProgressSafe(onProgress, 0, total)
+	outPath := filepath.Join(outputDir, fileName)
+	part, err := openResumablePart(outPath, SegmentURLs(segs), opt)
+	if err != nil {
+		return AudioResult{}, err
+	}
+	st := &mergeState{
+		out: &orderedSegmentWriter{
+			w:       io.MultiWriter(part.f, part.hash),
+			next:    part.next,
+			pending: map[int][]byte{},
+			written: part.offset,
+			onWrite: func(idx int, offset int64, size int) {
+				part.journal.add(idx, offset, size)
+			},
+		},
+		stream:     part.stream,
+		onGap:      func(g Gap) { part.journal.Gaps = append(part.journal.Gaps, g) },
+		checkpoint: part.checkpoint,
+	}
+	firstErr := a.mergeInOrder(ctx, segs, st, opt)
+	part.stream = st.stream
+	total := len(segs)
+	if firstErr == nil && len(part.journal.Gaps) == total {
+		// Pure silence is no recording; drop it so a rerun starts afresh.
+		_ = part.f.Close()
+		_ = os.Remove(part.f.Name())
+		_ = os.Remove(part.journalPath)
+		return AudioResult{}, fmt.Errorf("no segment could be fetched: %s", part.journal.Gaps[0].Reason)
+	}
+	if firstErr != nil {
+		// Keep the part file and journal so a rerun fetches only missing segments.
+		part.suspend()
+		return AudioResult{}, firstErr
+	}
+	if err := finalizePart(part.f, outPath); err != nil {
+		return AudioResult{}, err
+	}
+	_ = os.Remove(part.journalPath)
+	abs, _ := filepath.Abs(outPath)
+	gaps := part.journal.Gaps
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i].Index < gaps[j].Index })
+	return AudioResult{Path: abs, Size: st.out.written, SHA256: hex.EncodeToString(part.hash.Sum(nil)), Segments: total, Stream: part.stream, Gaps: gaps}, nil
+}
 
-	type task struct {
-		idx int
-		url string
+// StreamAacSegments downloads and cleans segments like
+// DownloadAndMergeAacSegments but writes the ordered stream to w as soon as
+// each segment is in order, with no part file or resume journal. The result
+// has no Path. On failure w may already hold part of the stream.
+func (a *AudioDownloader) StreamAacSegments(ctx context.Context, segs []Segment, w io.Writer, opt MergeOptions) (AudioResult, error) {
+	h := sha256.New()
+	sink := io.MultiWriter(w, h)
+	if _, err := sink.Write(opt.Header); err != nil {
+		return AudioResult{}, err
 	}
-	tasks := make(chan task)
-	results := make([][]byte, total)
-	errCh := make(chan error, 1)
-	var once sync.Once
-	var wg sync.WaitGroup
-	var doneMu sync.Mutex
-	done := 0
-
-	worker := func() {
-		defer wg.Done()
-		for t := range tasks {
-			_, b, err := a.net.GetBytes(ctx, t.url, nil)
-			if err != nil {
-				// Keep workers running so in-flight tasks can finish; report first error.
-				once.Do(func() { errCh <- fmt.Errorf("segment fetch failed: %w", err) })
-				continue
-			}
-			h := ParseAACPackedHeaderSize(b)
-			if h > len(b) {
-				h = 0
-			}
-			results[t.idx] = b[h:]
-			doneMu.Lock()
-			done++
-			onProgressSafe(onProgress, done, total)
-			doneMu.Unlock()
-		}
+	var gaps []Gap
+	st := &mergeState{
+		out:   &orderedSegmentWriter{w: sink, pending: map[int][]byte{}, written: int64(len(opt.Header))},
+		onGap: func(g Gap) { gaps = append(gaps, g) },
+	}
+	if err := a.mergeInOrder(ctx, segs, st, opt); err != nil {
+		return AudioResult{}, err
+	}
+	if len(segs) > 0 && len(gaps) == len(segs) {
+		return AudioResult{}, fmt.Errorf("no segment could be fetched: %s", gaps[0].Reason)
 	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i].Index < gaps[j].Index })
+	return AudioResult{Size: st.out.written, SHA256: hex.EncodeToString(h.Sum(nil)), Segments: len(segs), Stream: st.stream, Gaps: gaps}, nil
+}
+
+// mergeState is the output side of one merge: the ordered writer positioned
+// at the first segment still to fetch, the stream summary of what it already
+// holds, and hooks for gaps and periodic checkpoints.
+type mergeState struct {
+	out    *orderedSegmentWriter
+	stream ADTSInfo
+	onGap  func(Gap)
+	// checkpoint, when set, runs every journalInterval written segments.
+	checkpoint func() error
+}
+
+// mergeInOrder fetches segs from st.out.next on with bounded concurrency and
+// writes them to st.out in index order. Segment order is preserved even when
+// downloads complete out of order: finished segments wait in a bounded
+// reorder window until every earlier segment has been written, so memory use
+// does not grow with program length. The first unrecoverable error stops
+// dispatching and cancels in-flight fetches.
+func (a *AudioDownloader) mergeInOrder(parent context.Context, segs []Segment, st *mergeState, opt MergeOptions) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	gate := fetchGate{lane: opt.Pool.Lane(), retry: opt.Retry}
+	out := st.out
+	start := out.next
+	total := len(segs)
+	remaining := total - start
+	onProgressSafe(opt.OnProgress, start, total)
 
 	n := a.concurrency
-	if n > total && total > 0 {
-		n = total
+	if opt.Concurrency.Max > 0 {
+		// Run enough workers for the ceiling; the limiter decides how many fetch.
+		gate.limiter = newAIMDLimiter(opt.Concurrency, a.concurrency, opt.OnConcurrency)
+		n = gate.limiter.max
+	}
+	if n > remaining && remaining > 0 {
+		n = remaining
 	}
 	if n == 0 {
 		n = 1
 	}
+	// slots bounds dispatched-but-unwritten segments; the segment at out.next
+	// always holds a slot, so the window can never deadlock.
+	slots := make(chan struct{}, n*reorderWindowFactor)
+	tasks := make(chan int)
+	results := make(chan segmentResult, n)
+
+	go func() {
+		defer close(tasks)
+		for i := start; i < total; i++ {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case tasks <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
 	wg.Add(n)
-	for i := 0; i < n; i++ {
-		go worker()
+	for w := 0; w < n; w++ {
+		go func() {
+			defer wg.Done()
+			for idx := range tasks {
+				b, err := a.fetchSegment(ctx, gate, idx, segs[idx].URL)
+				if err != nil {
+					results <- segmentResult{idx: idx, err: err}
+					continue
+				}
+				h := ParseAACPackedHeaderSize(b)
+				if h > len(b) {
+					h = 0
+				}
+				clean, info := SanitizeADTS(b[h:])
+				if !opt.Window.IsZero() {
+					dropped := info.DroppedBytes
+					clean, info = TrimADTS(clean, segs[idx].Start, opt.Window)
+					info.DroppedBytes = dropped
+				}
+				results <- segmentResult{idx: idx, data: clean, info: info}
+			}
+		}()
 	}
-	for i, u := range urls {
-		select {
-		case <-ctx.Done():
-			close(tasks)
-			wg.Wait()
-			return "", ctx.Err()
-		default:
-			tasks <- task{idx: i, url: u}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var firstErr error
+	var failed []*SegmentError
+	fail := func(err error) {
+		var serr *SegmentError
+		// Fetches cut short by our own cancellation did not fail.
+		if errors.As(err, &serr) && (parent.Err() != nil || !errors.Is(err, context.Canceled)) {
+			failed = append(failed, serr)
+		}
+		cancel()
+	}
+	done := start
+	for r := range results {
+		if firstErr != nil || len(failed) > 0 {
+			// Keep draining so workers can exit; fetches that failed before
+			// the cancellation reached them are still reported.
+			if r.err != nil {
+				fail(r.err)
+			}
+			<-slots
+			continue
+		}
+		if r.err != nil && opt.BestEffort && parent.Err() == nil {
+			gap := Gap{Index: r.idx, URL: segs[r.idx].URL, Start: segs[r.idx].Start, Reason: r.err.Error()}
+			r.data, r.info = silentSegment(st.stream, segs[r.idx], opt.Window)
+			gap.Frames, gap.Seconds = r.info.Frames, r.info.Duration.Seconds()
+			st.onGap(gap)
+			r.err = nil
+		}
+		if r.err != nil {
+			fail(r.err)
+			for range len(out.pending) + 1 {
+				<-slots
+			}
+			out.pending = nil
+			continue
+		}
+		done++
+		onProgressSafe(opt.OnProgress, done, total)
+		st.stream.merge(r.info)
+		before := out.next
+		flushed, err := out.put(r.idx, r.data)
+		for range flushed {
+			<-slots
+		}
+		if err == nil && st.checkpoint != nil && out.next/journalInterval != before/journalInterval {
+			err = st.checkpoint()
+		}
+		if err != nil {
+			firstErr = err
+			cancel()
+			for range len(out.pending) {
+				<-slots
+			}
+			out.pending = nil
+		}
+	}
+	if len(failed) > 0 {
+		if err := parent.Err(); err != nil {
+			return fmt.Errorf("segment fetch interrupted: %w", err)
 		}
+		sort.Slice(failed, func(i, j int) bool { return failed[i].Index < failed[j].Index })
+		return &SegmentFetchError{Failed: failed, Total: total}
+	}
+	if firstErr == nil && out.next < total {
+		firstErr = parent.Err()
+		if firstErr == nil {
+			firstErr = fmt.Errorf("segment merge incomplete: %d/%d", out.next, total)
+		}
+	}
+	return firstErr
+}
+
+// fetchGate is what every fetch attempt of one merge passes through.
+type fetchGate struct {
+	lane    *FetchLane
+	limiter *aimdLimiter
+	retry   SegmentRetry
+}
+
+// fetchSegment fetches one segment, retrying any failure per gate.retry. A
+// non-2xx response counts as a failure. Each attempt holds a limiter slot and
+// a pool slot; the client's own retries are off, so backoffs and Retry-After
+// waits occupy neither. The error is a *SegmentError.
+func (a *AudioDownloader) fetchSegment(ctx context.Context, gate fetchGate, idx int, url string) ([]byte, error) {
+	serr := &SegmentError{Index: idx, URL: url}
+	retry := gate.retry
+	once := netx.WithRetryClassifier(ctx, func(error) bool { return false })
+	attempt := func() ([]byte, error) {
+		if err := gate.limiter.acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer gate.limiter.release()
+		if err := gate.lane.Acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer gate.lane.Release()
+		serr.Attempts++
+		status, b, err := a.net.GetBytes(once, url, nil)
+		var se *netx.StatusError
+		if errors.As(err, &se) {
+			// 5xx/429 responses surface without a response status.
+			status = se.Status
+		}
+		serr.Status = status
+		if err == nil && (status < 200 || status >= 300) {
+			err = fmt.Errorf("HTTP %d", status)
+		}
+		gate.limiter.observe(len(b), status, err)
+		return b, err
+	}
+	var b []byte
+	var err error
+	if retry.Attempts > 0 {
+		b, err = netx.RetryOperation(ctx, netx.RetryOptions{Retries: retry.Attempts, BaseDelay: retry.Delay, MaxDelay: 8 * retry.Delay}, attempt)
+	} else {
+		b, err = attempt()
 	}
-	close(tasks)
-	wg.Wait()
+	if err != nil {
+		serr.Err = err
+		return nil, serr
+	}
+	return b, nil
+}
 
-	select {
-	case err := <-errCh:
-		return "", err
-	default:
+// silentSegment returns silence standing in for seg, using the codec
+// parameters of stream and trimmed to window like fetched audio.
+func silentSegment(stream ADTSInfo, seg Segment, window TimeRange) ([]byte, ADTSInfo) {
+	dur := seg.Duration
+	if dur <= 0 {
+		dur = defaultSegmentDuration
 	}
+	frame := stream.FrameDuration()
+	if frame == 0 {
+		frame = adtsDuration(1, 48000)
+	}
+	n := int((dur + frame - 1) / frame)
+	data, info := TrimADTS(silentADTSFrames(stream, n), seg.Start, window)
+	info.SilentFrames = info.Frames
+	return data, info
+}
+
+// reorderWindowFactor sizes the reorder window as a multiple of the worker
+// count, leaving room for uneven segment latency without unbounded buffering.
+const reorderWindowFactor = 4
+
+// orderedSegmentWriter writes segments strictly in index order, holding
+// out-of-order arrivals until every earlier segment has been written.
+type orderedSegmentWriter struct {
+	w       io.Writer
+	next    int
+	pending map[int][]byte
+	written int64
+	// onWrite, when set, observes each segment's index, file offset, and size.
+	onWrite func(idx int, offset int64, size int)
+}
 
-	finalSize := 0
-	for _, seg := range results {
-		finalSize += len(seg)
+// put stores seg and flushes the contiguous run starting at next. It returns
+// how many segments were written.
+func (o *orderedSegmentWriter) put(idx int, seg []byte) (int, error) {
+	o.pending[idx] = seg
+	flushed := 0
+	for {
+		b, ok := o.pending[o.next]
+		if !ok {
+			return flushed, nil
+		}
+		delete(o.pending, o.next)
+		idx, offset := o.next, o.written
+		o.next++
+		flushed++
+		n, err := o.w.Write(b)
+		o.written += int64(n)
+		if err != nil {
+			return flushed, err
+		}
+		if o.onWrite != nil {
+			o.onWrite(idx, offset, n)
+		}
 	}
-	buf := mergeBufferPool.Get().(*bytes.Buffer)
-	buf.Reset()
-	buf.Grow(finalSize)
-	for _, seg := range results {
-		_, _ = buf.Write(seg)
+}
+
+// PartSuffix marks in-progress outputs that have not been renamed into place.
+const PartSuffix = ".part"
+
+// PartPath returns the in-progress path used while writing outPath.
+func PartPath(outPath string) string {
+	return outPath + PartSuffix
+}
+
+// finalizePart fsyncs and closes the part file, then renames it to outPath so a
+// crash never leaves a truncated final file.
+func finalizePart(f *os.File, outPath string) error {
+	part := f.Name()
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(part)
+		return err
 	}
-	outPath := filepath.Join(outputDir, fileName)
-	data := append([]byte(nil), buf.Bytes()...)
-	mergeBufferPool.Put(buf)
-	if err := os.WriteFile(outPath, data, 0o644); err != nil {
-		return "", err
+	if err := f.Close(); err != nil {
+		_ = os.Remove(part)
+		return err
 	}
-	abs, _ := filepath.Abs(outPath)
-	return abs, nil
+	return os.Rename(part, outPath)
+}
+
+// RemoveStalePartFiles deletes leftover part files in dir that cannot be
+// resumed and returns the removed paths. Part files with a resume journal are
+// kept so a rerun of the same program continues them. It is meant to run
+// before any download starts; a part file that another live process is
+// writing would otherwise be removed too.
+func RemoveStalePartFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	removed := make([]string, 0)
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != PartSuffix {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(p + JournalSuffix); err == nil {
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			return removed, err
+		}
+		removed = append(removed, p)
+	}
+	return removed, nil
 }
 
 func onProgressSafe(fn func(done, total int), done, total int) {
@@ -3,17 +3,32 @@ package domain
 import (
 	"bytes"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"rajidou/internal/netx"
+	"rajidou/internal/util"
 )
 
+// testSegments wraps urls as 5-second segments starting at a fixed time.
+func testSegments(urls ...string) []Segment {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, util.Tokyo)
+	out := make([]Segment, len(urls))
+	for i, u := range urls {
+		out[i] = Segment{URL: u, Start: start.Add(time.Duration(i) * 5 * time.Second), Duration: 5 * time.Second}
+	}
+	return out
+}
+
 func TestParseAACPackedHeaderSize(t *testing.T) {
 	if got := ParseAACPackedHeaderSize([]byte{0x00}); got != 0 {
 		t.Fatalf("want 0, got %d", got)
@@ -24,13 +39,21 @@ func TestParseAACPackedHeaderSize(t *testing.T) {
 	}
 }
 
+func TestParseAACPackedHeaderSizeReadsSyncsafeTagSize(t *testing.T) {
+	// 311 bytes: 0x02<<7 | 0x37. Read as a plain integer it would be 567.
+	id3 := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0x02, 0x37}
+	if got := ParseAACPackedHeaderSize(id3); got != 321 {
+		t.Fatalf("want 321, got %d", got)
+	}
+}
+
 func TestDownloadAndMergeAacSegments(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case "/a":
-			_, _ = w.Write([]byte{'I', 'D', '3', 0, 0, 0, 0, 0, 0, 1, 0xAA, 0x01, 0x02})
+			_, _ = w.Write(append([]byte{'I', 'D', '3', 0, 0, 0, 0, 0, 0, 1, 0xAA}, testADTSFrameFill(2, 0x01)...))
 		case "/b":
-			_, _ = w.Write([]byte{0x03, 0x04})
+			_, _ = w.Write(testADTSFrameFill(2, 0x03))
 		default:
 			w.WriteHeader(http.StatusNotFound)
 		}
@@ -41,27 +64,33 @@ func TestDownloadAndMergeAacSegments(t *testing.T) {
 	d := NewAudioDownloader(net, 2)
 	tmp := t.TempDir()
 	var progress int32
-	out, err := d.DownloadAndMergeAacSegments(context.Background(), []string{s.URL + "/a", s.URL + "/b"}, tmp, "x.aac", func(done, total int) {
+	out, err := d.DownloadAndMergeAacSegments(context.Background(), testSegments(s.URL+"/a", s.URL+"/b"), tmp, "x.aac", MergeOptions{OnProgress: func(done, total int) {
 		if done == total {
 			atomic.StoreInt32(&progress, 1)
 		}
-	})
+	}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if atomic.LoadInt32(&progress) != 1 {
 		t.Fatal("expected progress callback")
 	}
-	b, err := os.ReadFile(out)
+	b, err := os.ReadFile(out.Path)
 	if err != nil {
 		t.Fatalf("read output: %v", err)
 	}
-	want := []byte{0x01, 0x02, 0x03, 0x04}
+	want := append(testADTSFrameFill(2, 0x01), testADTSFrameFill(2, 0x03)...)
 	if !bytes.Equal(b, want) {
 		t.Fatalf("want %v, got %v", want, b)
 	}
-	if filepath.Ext(out) != ".aac" {
-		t.Fatalf("unexpected output file: %s", out)
+	if filepath.Ext(out.Path) != ".aac" {
+		t.Fatalf("unexpected output file: %s", out.Path)
+	}
+	if out.Size != int64(len(want)) || out.Segments != 2 || len(out.SHA256) != 64 {
+		t.Fatalf("unexpected result: %+v", out)
+	}
+	if out.Stream.Frames != 2 || out.Stream.SampleRate != 48000 || out.Stream.Profile != "AAC LC" {
+		t.Fatalf("unexpected stream info: %+v", out.Stream)
 	}
 }
 
@@ -73,8 +102,403 @@ func TestDownloadAndMergeAacSegmentsError(t *testing.T) {
 
 	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 0, BaseDelay: time.Millisecond})
 	d := NewAudioDownloader(net, 1)
-	_, err := d.DownloadAndMergeAacSegments(context.Background(), []string{s.URL + "/bad"}, t.TempDir(), "x.aac", nil)
+	_, err := d.DownloadAndMergeAacSegments(context.Background(), testSegments(s.URL+"/bad"), t.TempDir(), "x.aac", MergeOptions{})
 	if err == nil {
 		t.Fatal("expected error")
 	}
 }
+
+func TestDownloadAndMergeAacSegmentsReplacesLeftoverPart(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testADTSFrameFill(1, 0x01))
+	}))
+	defer s.Close()
+
+	tmp := t.TempDir()
+	if err := os.WriteFile(PartPath(filepath.Join(tmp, "x.aac")), []byte("stale"), 0o644); err != nil {
+		t.Fatalf("seed part: %v", err)
+	}
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	out, err := NewAudioDownloader(net, 1).DownloadAndMergeAacSegments(context.Background(), testSegments(s.URL), tmp, "x.aac", MergeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(PartPath(out.Path)); !os.IsNotExist(err) {
+		t.Fatalf("part file should be renamed away, stat err=%v", err)
+	}
+	if b, _ := os.ReadFile(out.Path); !bytes.Equal(b, testADTSFrameFill(1, 0x01)) {
+		t.Fatalf("unexpected output: %v", b)
+	}
+}
+
+func TestStreamAacSegmentsWritesInOrder(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		// Later segments answer first so the writer has to reorder.
+		time.Sleep(time.Duration(5-n) * time.Millisecond)
+		_, _ = w.Write(testADTSFrameFill(1, byte(n)))
+	}))
+	defer s.Close()
+
+	header := buildID3Tag(id3Text("TIT2", "x"))
+	urls := make([]string, 5)
+	want := append([]byte{}, header...)
+	for i := range urls {
+		urls[i] = s.URL + "/" + strconv.Itoa(i)
+		want = append(want, testADTSFrameFill(1, byte(i))...)
+	}
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 0, BaseDelay: time.Millisecond})
+	var buf bytes.Buffer
+	out, err := NewAudioDownloader(net, 3).StreamAacSegments(context.Background(), testSegments(urls...), &buf, MergeOptions{Header: header})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) || out.Size != int64(len(want)) || out.Stream.Frames != len(urls) || out.Path != "" {
+		t.Fatalf("unexpected stream: %+v %v", out, buf.Bytes())
+	}
+}
+
+func TestRemoveStalePartFiles(t *testing.T) {
+	tmp := t.TempDir()
+	for _, name := range []string{"a.aac.part", "b.aac", "c.json"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), nil, 0o644); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	removed, err := RemoveStalePartFiles(tmp)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(removed) != 1 || filepath.Base(removed[0]) != "a.aac.part" {
+		t.Fatalf("unexpected removed list: %v", removed)
+	}
+	if removed, err := RemoveStalePartFiles(filepath.Join(tmp, "missing")); err != nil || len(removed) != 0 {
+		t.Fatalf("missing dir should be a no-op: %v %v", removed, err)
+	}
+}
+
+func TestDownloadAndMergeAacSegmentsKeepsOrderWithSlowSegments(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if n%7 == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		_, _ = w.Write(testADTSFrameFill(1, byte(n)))
+	}))
+	defer s.Close()
+
+	urls := make([]string, 40)
+	want := make([]byte, 0, len(urls)*8)
+	for i := range urls {
+		urls[i] = s.URL + "/" + strconv.Itoa(i)
+		want = append(want, testADTSFrameFill(1, byte(i))...)
+	}
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	out, err := NewAudioDownloader(net, 3).DownloadAndMergeAacSegments(context.Background(), testSegments(urls...), t.TempDir(), "x.aac", MergeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := os.ReadFile(out.Path)
+	if !bytes.Equal(b, want) {
+		t.Fatalf("segments out of order: %v", b)
+	}
+}
+
+func TestDownloadAndMergeAacSegmentsDropsJunkAtJoins(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		frame := testADTSFrameFill(4, 0x05)
+		// Leftover metadata before the frame and a cut-off frame after it.
+		_, _ = w.Write(append(append([]byte("TAG-junk"), frame...), frame[:6]...))
+	}))
+	defer s.Close()
+
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	out, err := NewAudioDownloader(net, 1).DownloadAndMergeAacSegments(context.Background(), testSegments(s.URL), t.TempDir(), "x.aac", MergeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := os.ReadFile(out.Path)
+	if !bytes.Equal(b, testADTSFrameFill(4, 0x05)) {
+		t.Fatalf("junk not dropped: %v", b)
+	}
+	if out.Stream.DroppedBytes != 14 {
+		t.Fatalf("want 14 dropped bytes, got %d", out.Stream.DroppedBytes)
+	}
+}
+
+func TestOrderedSegmentWriterHoldsUntilContiguous(t *testing.T) {
+	var buf bytes.Buffer
+	w := &orderedSegmentWriter{w: &buf, pending: map[int][]byte{}}
+	if n, _ := w.put(1, []byte("b")); n != 0 || buf.Len() != 0 {
+		t.Fatalf("segment 1 must wait for 0, flushed=%d", n)
+	}
+	if n, _ := w.put(0, []byte("a")); n != 2 || buf.String() != "ab" {
+		t.Fatalf("unexpected flush: %d %q", n, buf.String())
+	}
+	if w.written != 2 || len(w.pending) != 0 {
+		t.Fatalf("unexpected state: written=%d pending=%d", w.written, len(w.pending))
+	}
+}
+
+func TestDownloadAndMergeAacSegmentsTrimsToWindow(t *testing.T) {
+	// Each segment holds 3 frames of 1024 samples at 48kHz (64ms total).
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fill := byte(r.URL.Path[1])
+		_, _ = w.Write(bytes.Repeat(testADTSFrameFill(2, fill), 3))
+	}))
+	defer s.Close()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, util.Tokyo)
+	frame := 1024 * time.Second / 48000
+	segs := []Segment{
+		{URL: s.URL + "/a", Start: start, Duration: 3 * frame},
+		{URL: s.URL + "/b", Start: start.Add(3 * frame), Duration: 3 * frame},
+	}
+	// Keep from the second frame of segment a up to (not including) the last frame of segment b.
+	window := TimeRange{From: start.Add(frame), Until: start.Add(5 * frame)}
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	out, err := NewAudioDownloader(net, 2).DownloadAndMergeAacSegments(context.Background(), segs, t.TempDir(), "x.aac", MergeOptions{Window: window})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := os.ReadFile(out.Path)
+	want := append(bytes.Repeat(testADTSFrameFill(2, 'a'), 2), bytes.Repeat(testADTSFrameFill(2, 'b'), 2)...)
+	if !bytes.Equal(b, want) {
+		t.Fatalf("unexpected trimmed output: %v", b)
+	}
+	if out.Stream.Frames != 4 || out.Stream.TrimmedFrames != 2 || out.Stream.Duration != adtsDuration(4, 48000) {
+		t.Fatalf("unexpected stream info: %+v", out.Stream)
+	}
+}
+
+func TestDownloadAndMergeAacSegmentsBestEffortFillsGaps(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/2" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(testADTSFrame(4))
+	}))
+	defer s.Close()
+
+	urls := make([]string, 5)
+	for i := range urls {
+		urls[i] = s.URL + "/" + strconv.Itoa(i)
+	}
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 0, BaseDelay: time.Millisecond})
+	d := NewAudioDownloader(net, 2)
+	tmp := t.TempDir()
+	if _, err := d.DownloadAndMergeAacSegments(context.Background(), testSegments(urls...), tmp, "strict.aac", MergeOptions{}); err == nil || !strings.Contains(err.Error(), "HTTP 404") {
+		t.Fatalf("want a 404 failure without best effort, got %v", err)
+	}
+	out, err := d.DownloadAndMergeAacSegments(context.Background(), testSegments(urls...), tmp, "x.aac", MergeOptions{BestEffort: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// A 5s segment at 48kHz needs ceil(5s / 21.33ms) = 235 silent frames.
+	if len(out.Gaps) != 1 || out.Gaps[0].Index != 2 || out.Gaps[0].Frames != 235 || out.Stream.SilentFrames != 235 {
+		t.Fatalf("unexpected gaps: %+v stream %+v", out.Gaps, out.Stream)
+	}
+	f, err := os.Open(out.Path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	info, err := AnalyzeADTS(f)
+	if err != nil || info.Frames != 4+235 || info.SampleRate != 48000 || info.ChannelConfig != 2 {
+		t.Fatalf("filled output must stay a valid stream: %+v %v", info, err)
+	}
+}
+
+func TestDownloadAndMergeAacSegmentsBestEffortNeedsSomeAudio(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 0, BaseDelay: time.Millisecond})
+	tmp := t.TempDir()
+	_, err := NewAudioDownloader(net, 1).DownloadAndMergeAacSegments(context.Background(), testSegments(s.URL+"/a", s.URL+"/b"), tmp, "x.aac", MergeOptions{BestEffort: true})
+	if err == nil {
+		t.Fatal("expected an error when every segment is missing")
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Fatalf("nothing should be left behind, got %d entries", len(entries))
+	}
+}
+
+func TestDownloadAndMergeAacSegmentsRetriesSegments(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+		// /1 is missing on the first fetch only; /3 never appears.
+		if (r.URL.Path == "/1" && n == 1) || r.URL.Path == "/3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(testADTSFrame(4))
+	}))
+	defer s.Close()
+
+	urls := make([]string, 5)
+	for i := range urls {
+		urls[i] = s.URL + "/" + strconv.Itoa(i)
+	}
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	// One worker keeps the retried /1 finished before /3 stops the merge.
+	d := NewAudioDownloader(net, 1)
+	opt := MergeOptions{Retry: SegmentRetry{Attempts: 2, Delay: time.Millisecond}}
+	_, err := d.DownloadAndMergeAacSegments(context.Background(), testSegments(urls...), t.TempDir(), "x.aac", opt)
+	var fetchErr *SegmentFetchError
+	if !errors.As(err, &fetchErr) {
+		t.Fatalf("want a SegmentFetchError, got %v", err)
+	}
+	if len(fetchErr.Failed) != 1 || fetchErr.Total != 5 {
+		t.Fatalf("want segment 3 reported, got %v", err)
+	}
+	if f := fetchErr.Failed[0]; f.Index != 3 || f.URL != urls[3] || f.Status != http.StatusNotFound || f.Attempts != 3 {
+		t.Fatalf("unexpected failure: %+v", f)
+	}
+	if !strings.Contains(err.Error(), "1 of 5 segments") || !strings.Contains(err.Error(), urls[3]) {
+		t.Fatalf("unexpected message: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["/1"] != 2 {
+		t.Fatalf("a 404 segment must be retried, got %d fetches", hits["/1"])
+	}
+}
+
+func TestDownloadAndMergeAacSegmentsReportsEveryFailedSegment(t *testing.T) {
+	release := make(chan struct{})
+	served := make(chan struct{}, 2)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// /3 and /4 fail together once the good segments are merged.
+		if r.URL.Path == "/3" || r.URL.Path == "/4" {
+			<-release
+			w.WriteHeader(http.StatusNotFound)
+			served <- struct{}{}
+			return
+		}
+		_, _ = w.Write(testADTSFrame(4))
+	}))
+	defer s.Close()
+
+	urls := make([]string, 5)
+	for i := range urls {
+		urls[i] = s.URL + "/" + strconv.Itoa(i)
+	}
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 0, BaseDelay: time.Millisecond})
+	opt := MergeOptions{OnProgress: func(done, total int) {
+		if done != 3 {
+			return
+		}
+		// Hold the merge until both failures are fetched so neither is
+		// cut short by the cancellation the first one triggers.
+		close(release)
+		<-served
+		<-served
+		time.Sleep(20 * time.Millisecond)
+	}}
+	_, err := NewAudioDownloader(net, 2).DownloadAndMergeAacSegments(context.Background(), testSegments(urls...), t.TempDir(), "x.aac", opt)
+	var fetchErr *SegmentFetchError
+	if !errors.As(err, &fetchErr) {
+		t.Fatalf("want a SegmentFetchError, got %v", err)
+	}
+	if len(fetchErr.Failed) != 2 || fetchErr.Total != 5 {
+		t.Fatalf("want segments 3 and 4 reported, got %v", err)
+	}
+	for i, f := range fetchErr.Failed {
+		if f.Index != 3+i || f.URL != urls[3+i] || f.Status != http.StatusNotFound {
+			t.Fatalf("unexpected failure %d: %+v", i, f)
+		}
+		if !strings.Contains(err.Error(), urls[3+i]) {
+			t.Fatalf("message misses segment %d: %v", 3+i, err)
+		}
+	}
+	if !strings.Contains(err.Error(), "2 of 5 segments") {
+		t.Fatalf("unexpected message: %v", err)
+	}
+}
+
+func TestDownloadAndMergeAacSegmentsReportsStatusAfterServerErrors(t *testing.T) {
+	var hits atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/1" {
+			hits.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(testADTSFrame(4))
+	}))
+	defer s.Close()
+
+	urls := []string{s.URL + "/0", s.URL + "/1"}
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 3, BaseDelay: time.Millisecond})
+	opt := MergeOptions{Retry: SegmentRetry{Attempts: 1, Delay: time.Millisecond}}
+	_, err := NewAudioDownloader(net, 1).DownloadAndMergeAacSegments(context.Background(), testSegments(urls...), t.TempDir(), "x.aac", opt)
+	var fetchErr *SegmentFetchError
+	if !errors.As(err, &fetchErr) || len(fetchErr.Failed) != 1 {
+		t.Fatalf("want one failed segment, got %v", err)
+	}
+	if f := fetchErr.Failed[0]; f.Index != 1 || f.Status != http.StatusServiceUnavailable || f.Attempts != 2 {
+		t.Fatalf("unexpected failure: %+v", f)
+	}
+	// Segment retries replace the client's, which would hold the fetch slots.
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("want 2 requests for the failing segment, got %d", got)
+	}
+}
+
+func TestDownloadAndMergeAacSegmentsStopsOnFirstFailure(t *testing.T) {
+	var hits atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/0":
+			w.WriteHeader(http.StatusNotFound)
+		case "/1":
+			// In flight when /0 fails; must be cancelled, not awaited.
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		default:
+			_, _ = w.Write(testADTSFrame(4))
+		}
+	}))
+	defer s.Close()
+
+	urls := make([]string, 50)
+	for i := range urls {
+		urls[i] = s.URL + "/" + strconv.Itoa(i)
+	}
+	net := netx.NewClient(10*time.Second, netx.RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	begin := time.Now()
+	_, err := NewAudioDownloader(net, 2).DownloadAndMergeAacSegments(context.Background(), testSegments(urls...), t.TempDir(), "x.aac", MergeOptions{})
+	var fetchErr *SegmentFetchError
+	if !errors.As(err, &fetchErr) || len(fetchErr.Failed) != 1 || fetchErr.Failed[0].Index != 0 {
+		t.Fatalf("want only segment 0 reported, got %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 2*time.Second {
+		t.Fatalf("in-flight fetches must be cancelled, took %s", elapsed)
+	}
+	if n := hits.Load(); n > 10 {
+		t.Fatalf("dispatching must stop after the failure, got %d requests", n)
+	}
+}
+
+func TestID3ChaptersCapsTableOfContents(t *testing.T) {
+	chapters := make([]id3Chapter, 300)
+	for i := range chapters {
+		chapters[i] = id3Chapter{title: strconv.Itoa(i), start: time.Duration(i) * time.Second, end: time.Duration(i+1) * time.Second}
+	}
+	frames := id3Chapters(chapters)
+	if len(frames) != maxID3Chapters+1 || frames[0].id != "CTOC" || frames[0].body[5] != maxID3Chapters {
+		t.Fatalf("want CTOC counting %d chapters, got %d frames, count %d", maxID3Chapters, len(frames), frames[0].body[5])
+	}
+}
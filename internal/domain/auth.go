@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -75,7 +76,9 @@ func (a *AuthClient) RetrieveToken(ctx context.Context, areaID string) (string,
 	if err != nil {
 		return "", err
 	}
-	defer auth1Resp.Body.Close()
+	// Only the headers matter; closing now frees the host slot auth2 needs.
+	_, _ = io.Copy(io.Discard, auth1Resp.Body)
+	_ = auth1Resp.Body.Close()
 	if auth1Resp.StatusCode < 200 || auth1Resp.StatusCode >= 300 {
 		return "", fmt.Errorf("auth1 failed: %d", auth1Resp.StatusCode)
 	}
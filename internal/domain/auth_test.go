@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -99,6 +100,47 @@ func TestRetrieveTokenSuccess(t *testing.T) {
 	}
 }
 
+func TestRetrieveTokenConcurrentlyUnderDefaultHostLimits(t *testing.T) {
+	const clients = 4
+	var arrived atomic.Int32
+	all := make(chan struct{})
+	net, closeFn := newMockNetClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/api/auth1" {
+			// Answer once every client holds a slot for its auth1.
+			if arrived.Add(1) == clients {
+				close(all)
+			}
+			select {
+			case <-all:
+			case <-time.After(time.Second):
+			}
+			w.Header().Set("x-radiko-authtoken", "tok")
+			w.Header().Set("x-radiko-keyoffset", "0")
+			w.Header().Set("x-radiko-keylength", "8")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	defer closeFn()
+	net.SetHostLimiter(netx.NewHostLimiter(netx.DefaultHostLimits()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errs := make(chan error, clients)
+	for i := 0; i < clients; i++ {
+		a := NewAuthClient(net)
+		a.cachePath = filepath.Join(t.TempDir(), "auth.json")
+		go func() {
+			_, err := a.RetrieveToken(ctx, "JP13")
+			errs <- err
+		}()
+	}
+	for i := 0; i < clients; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("token fetch %d: %v", i, err)
+		}
+	}
+}
+
 func TestRetrieveTokenAuth1Errors(t *testing.T) {
 	tests := []struct {
 		name    string
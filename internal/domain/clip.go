@@ -0,0 +1,224 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"rajidou/internal/util"
+)
+
+// Source map in this file:
+//   - partial-range downloads are CLI-specific with no Rajiko counterpart.
+//
+// LinkSpec is one input: a link with an optional sub-range of the program, a
+// group of links joined into one output, or every program of a station in a
+// time span, also joined.
+type LinkSpec struct {
+	URL   string
+	Range RangeSpec
+	// Join lists further links whose programs follow URL's program in the
+	// same output.
+	Join []string
+	// StationID and Span select programs by time instead of by URL.
+	StationID string
+	Span      TimeRange
+}
+
+// ParseLinkSpec parses one of
+//
+//	<url> [range]
+//	<url> + <url> [+ <url>...]
+//	<station-id> <YYYYMMDDHHMMSS>..<YYYYMMDDHHMMSS>
+//
+// See ParseRangeSpec for the range syntax.
+func ParseLinkSpec(s string) (LinkSpec, error) {
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 0:
+		return LinkSpec{}, fmt.Errorf("empty link")
+	case 1:
+		return LinkSpec{URL: fields[0]}, nil
+	}
+	if len(fields) >= 3 && fields[1] == "+" {
+		l := LinkSpec{URL: fields[0]}
+		for i := 1; i < len(fields); i += 2 {
+			if fields[i] != "+" || i+1 >= len(fields) {
+				return LinkSpec{}, fmt.Errorf("invalid link group %q: want \"<url> + <url>...\"", s)
+			}
+			l.Join = append(l.Join, fields[i+1])
+		}
+		return l, nil
+	}
+	if !strings.Contains(fields[0], "://") {
+		return parseSpanSpec(s, fields)
+	}
+	if len(fields) != 2 {
+		return LinkSpec{}, fmt.Errorf("invalid link %q: want \"<url> [range]\"", s)
+	}
+	r, err := ParseRangeSpec(fields[1])
+	if err != nil {
+		return LinkSpec{}, err
+	}
+	return LinkSpec{URL: fields[0], Range: r}, nil
+}
+
+func parseSpanSpec(s string, fields []string) (LinkSpec, error) {
+	if len(fields) != 2 {
+		return LinkSpec{}, fmt.Errorf("invalid link %q: want \"<station-id> <from>..<until>\"", s)
+	}
+	r, err := ParseRangeSpec(fields[1])
+	if err != nil {
+		return LinkSpec{}, err
+	}
+	if r.From.kind != 't' || r.Until.kind != 't' || !r.From.at.Before(r.Until.at) {
+		return LinkSpec{}, fmt.Errorf("invalid span %q: want YYYYMMDDHHMMSS..YYYYMMDDHHMMSS", fields[1])
+	}
+	return LinkSpec{StationID: fields[0], Span: TimeRange{From: r.From.at, Until: r.Until.at}}, nil
+}
+
+// String returns a short description of l for logs.
+func (l LinkSpec) String() string {
+	if l.StationID != "" {
+		return fmt.Sprintf("%s %s..%s", l.StationID, util.FormatTimestamp(l.Span.From), util.FormatTimestamp(l.Span.Until))
+	}
+	return strings.Join(append([]string{l.URL}, l.Join...), " + ")
+}
+
+// RangeSpec selects part of a program. Each bound is a TimePoint; an empty
+// bound defaults to the program boundary.
+type RangeSpec struct {
+	From  TimePoint
+	Until TimePoint
+}
+
+// TimePoint is a moment in a program given as an offset from ft
+// ("+HH:MM[:SS]"), a clock time on the broadcast day ("HH:MM[:SS]", hours may
+// run past 24 as in Radiko's schedule), or an absolute "YYYYMMDDHHMMSS"
+// timestamp.
+type TimePoint struct {
+	kind  byte // 0 unset, '+' offset from ft, 'c' clock time, 't' timestamp
+	value time.Duration
+	at    time.Time
+}
+
+// IsZero reports whether s selects the whole program.
+func (s RangeSpec) IsZero() bool {
+	return s.From.kind == 0 && s.Until.kind == 0
+}
+
+// ParseRangeSpec parses "<from>..<until>", for example "+00:45:00..+01:10:00"
+// or "21:30..22:00".
+func ParseRangeSpec(s string) (RangeSpec, error) {
+	from, until, ok := strings.Cut(s, "..")
+	if !ok {
+		return RangeSpec{}, fmt.Errorf("invalid range %q: want <from>..<until>", s)
+	}
+	var r RangeSpec
+	var err error
+	if r.From, err = parseTimePoint(from); err != nil {
+		return RangeSpec{}, fmt.Errorf("invalid range %q: %w", s, err)
+	}
+	if r.Until, err = parseTimePoint(until); err != nil {
+		return RangeSpec{}, fmt.Errorf("invalid range %q: %w", s, err)
+	}
+	if r.IsZero() {
+		return RangeSpec{}, fmt.Errorf("invalid range %q: both bounds are empty", s)
+	}
+	return r, nil
+}
+
+// ParseTimePoint parses a non-empty TimePoint.
+func ParseTimePoint(s string) (TimePoint, error) {
+	if s == "" {
+		return TimePoint{}, fmt.Errorf("empty time")
+	}
+	return parseTimePoint(s)
+}
+
+func parseTimePoint(s string) (TimePoint, error) {
+	switch {
+	case s == "":
+		return TimePoint{}, nil
+	case strings.HasPrefix(s, "+"):
+		d, err := parseClock(s[1:])
+		return TimePoint{kind: '+', value: d}, err
+	case strings.Contains(s, ":"):
+		d, err := parseClock(s)
+		return TimePoint{kind: 'c', value: d}, err
+	}
+	t, err := util.ParseTimestamp(s)
+	return TimePoint{kind: 't', at: t}, err
+}
+
+// parseClock parses "HH:MM" or "HH:MM:SS" into a duration.
+func parseClock(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var d time.Duration
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || (i > 0 && n > 59) {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		d = d*60 + time.Duration(n)
+	}
+	if len(parts) == 2 {
+		d *= 60
+	}
+	return d * time.Second, nil
+}
+
+// Resolve turns s into broadcast times within program, which must be set.
+// The result is clipped to program and must not be empty.
+func (s RangeSpec) Resolve(program TimeRange) (TimeRange, error) {
+	if program.From.IsZero() || program.Until.IsZero() {
+		return TimeRange{}, fmt.Errorf("program has no schedule to resolve a range against")
+	}
+	out := program
+	if s.From.kind != 0 {
+		out.From = s.From.Resolve(program.From)
+	}
+	if s.Until.kind != 0 {
+		out.Until = s.Until.Resolve(program.From)
+	}
+	if out.From.Before(program.From) {
+		out.From = program.From
+	}
+	if out.Until.After(program.Until) {
+		out.Until = program.Until
+	}
+	if !out.From.Before(out.Until) {
+		return TimeRange{}, fmt.Errorf("range does not overlap the program (%s - %s)",
+			util.FormatTimestamp(program.From), util.FormatTimestamp(program.Until))
+	}
+	return out, nil
+}
+
+// Resolve returns the broadcast time of p in the program starting at ft.
+func (p TimePoint) Resolve(ft time.Time) time.Time {
+	switch p.kind {
+	case '+':
+		return ft.Add(p.value)
+	case 'c':
+		day := time.Date(ft.Year(), ft.Month(), ft.Day(), 0, 0, 0, 0, ft.Location())
+		t := day.Add(p.value)
+		if t.Before(ft) && p.value < 24*time.Hour {
+			// A clock time earlier than ft belongs to the next day.
+			t = t.Add(24 * time.Hour)
+		}
+		return t
+	}
+	return p.at
+}
+
+// clipFileName marks a program file name with the clipped time range so a
+// clip never overwrites the full program.
+func clipFileName(name string, r TimeRange) string {
+	ext := ".aac"
+	base := strings.TrimSuffix(name, ext)
+	return fmt.Sprintf("%s (%s-%s)%s", base, r.From.Format("150405"), r.Until.Format("150405"), ext)
+}
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"rajidou/internal/util"
+)
+
+func TestParseLinkSpec(t *testing.T) {
+	l, err := ParseLinkSpec("https://radiko.jp/#!/ts/AAA/20260101000000  +00:45:00..+01:10:00")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if l.URL != "https://radiko.jp/#!/ts/AAA/20260101000000" || l.Range.IsZero() {
+		t.Fatalf("unexpected link: %+v", l)
+	}
+	if l, err := ParseLinkSpec("https://radiko.jp/#!/ts/AAA/20260101000000"); err != nil || !l.Range.IsZero() {
+		t.Fatalf("plain link: %+v %v", l, err)
+	}
+	for _, bad := range []string{"u a..b c", "u 10:00", "u ..", "u +1..", "u 10:75..", "u 2026..+01:00"} {
+		if _, err := ParseLinkSpec(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseLinkSpecGroupsAndSpans(t *testing.T) {
+	l, err := ParseLinkSpec("https://radiko.jp/#!/ts/AAA/20260101200000 + https://radiko.jp/#!/ts/AAA/20260101210000")
+	if err != nil || len(l.Join) != 1 || l.Join[0] != "https://radiko.jp/#!/ts/AAA/20260101210000" {
+		t.Fatalf("unexpected group: %+v %v", l, err)
+	}
+	l, err = ParseLinkSpec("AAA 20260101180000..20260101230000")
+	if err != nil || l.StationID != "AAA" || l.Span.Until.Sub(l.Span.From) != 5*time.Hour {
+		t.Fatalf("unexpected span: %+v %v", l, err)
+	}
+	for _, bad := range []string{"u + ", "u + v w", "AAA +01:00..+02:00", "AAA 20260101230000..20260101180000"} {
+		if _, err := ParseLinkSpec(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestRangeSpecResolve(t *testing.T) {
+	ft := time.Date(2026, 1, 1, 23, 0, 0, 0, util.Tokyo)
+	program := TimeRange{From: ft, Until: ft.Add(3 * time.Hour)}
+	tests := []struct {
+		spec      string
+		from, to  time.Duration
+		expectErr bool
+	}{
+		{spec: "+00:45:00..+01:10:00", from: 45 * time.Minute, to: 70 * time.Minute},
+		{spec: "+02:30..", from: 150 * time.Minute, to: 3 * time.Hour},
+		{spec: "..23:30", from: 0, to: 30 * time.Minute},
+		// Clock times before ft roll over to the next day, and Radiko's
+		// 24+ hour notation is accepted as is.
+		{spec: "00:15..25:00", from: 75 * time.Minute, to: 2 * time.Hour},
+		{spec: "20260101223000..20260101233000", from: 0, to: 30 * time.Minute},
+		{spec: "+04:00..", expectErr: true},
+	}
+	for _, tt := range tests {
+		r, err := ParseRangeSpec(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: parse: %v", tt.spec, err)
+		}
+		got, err := r.Resolve(program)
+		if tt.expectErr {
+			if err == nil {
+				t.Fatalf("%s: expected error, got %+v", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: resolve: %v", tt.spec, err)
+		}
+		if !got.From.Equal(ft.Add(tt.from)) || !got.Until.Equal(ft.Add(tt.to)) {
+			t.Fatalf("%s: unexpected range %s - %s", tt.spec, got.From, got.Until)
+		}
+	}
+}
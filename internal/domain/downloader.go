@@ -2,7 +2,11 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"path/filepath"
+	"time"
 
 	"rajidou/internal/netx"
 	"rajidou/internal/util"
@@ -16,6 +20,89 @@ type DownloadOptions struct {
 	OutputDir  string
 	AreaID     string
 	OnProgress func(done, total int)
+	// WriteInfoJSON writes a .json program record next to the audio output.
+	WriteInfoJSON bool
+	// WriteNFO writes a Kodi/Jellyfin-style .nfo next to the audio output.
+	WriteNFO bool
+	// Archive, when set, skips programs it already lists and records each
+	// completed download.
+	Archive *DownloadArchive
+	// CompletenessTolerance is how much shorter than the scheduled program
+	// length the decoded audio may be before it counts as incomplete.
+	CompletenessTolerance time.Duration
+	// FailIncomplete turns an incomplete download into an ErrIncomplete
+	// failure instead of a flagged success.
+	FailIncomplete bool
+	// TrimPadding keeps this much audio before ft and after to instead of
+	// trimming the output exactly to the program boundaries.
+	TrimPadding time.Duration
+	// Range, when set, downloads only that part of the program. Clips are
+	// neither skipped by nor recorded in the archive.
+	Range RangeSpec
+	// Split cuts the finished download into numbered, ID3-tagged parts.
+	Split SplitOptions
+	// BestEffort fills segments that cannot be fetched with silence instead
+	// of failing the download.
+	BestEffort bool
+	// SegmentRetry re-fetches failed segments; segment fetches skip the
+	// HTTP client's retries.
+	SegmentRetry SegmentRetry
+	// Pool, when set, is the fetch pool shared with other downloads.
+	Pool *FetchPool
+	// Concurrency bounds the adaptive segment concurrency; see MergeOptions.
+	Concurrency ConcurrencyLimits
+	// OnConcurrency observes each change of the adaptive segment concurrency.
+	OnConcurrency func(limit int)
+	// SongList writes the program's on-air song list as a .cue sheet and a
+	// tracklist, and embeds it as ID3 chapters when the output has no program
+	// chapters. Song list failures become warnings.
+	SongList bool
+	// Output, when set, receives the audio stream instead of a file in
+	// OutputDir. Streams are neither skipped by nor recorded in the archive,
+	// are not split, and get no sidecars, song list files or manifest entry.
+	Output io.Writer
+}
+
+// ErrIncomplete reports audio that is shorter than its scheduled program
+// length by more than the configured tolerance.
+var ErrIncomplete = errors.New("download is shorter than the scheduled program")
+
+// DownloadResult describes one finished download for the run report.
+type DownloadResult struct {
+	Path string
+	// Expected is the length of the trimmed window: the scheduled program or
+	// clip plus the trim padding on both sides.
+	Expected time.Duration
+	// Actual is the decoded audio duration.
+	Actual time.Duration
+	// Incomplete is set when Shortfall exceeds the configured tolerance.
+	Incomplete bool
+	// Parts lists every output file when the download was split; Path is
+	// then the first part.
+	Parts []string
+	// Gaps lists segments filled with silence in best-effort mode.
+	Gaps []Gap
+	// Warnings lists problems that did not fail the download.
+	Warnings []string
+}
+
+// GapDuration returns the total length of the silence filled into gaps.
+func (r DownloadResult) GapDuration() time.Duration {
+	var sec float64
+	for _, g := range r.Gaps {
+		sec += g.Seconds
+	}
+	return time.Duration(sec * float64(time.Second))
+}
+
+// Shortfall returns how much less audio than Expected the download holds.
+// Silence filled into gaps does not count as audio.
+func (r DownloadResult) Shortfall() time.Duration {
+	audio := r.Actual - r.GapDuration()
+	if audio >= r.Expected {
+		return 0
+	}
+	return r.Expected - audio
 }
 
 type resolverAPI interface {
@@ -28,14 +115,20 @@ type authAPI interface {
 
 type programAPI interface {
 	ResolveProgramMeta(ctx context.Context, stationID, ft string) (ProgramMeta, error)
+	ListPrograms(ctx context.Context, stationID string) ([]ProgramMeta, error)
 }
 
 type playlistAPI interface {
-	BuildSegmentURLs(ctx context.Context, in SegmentInput) ([]string, error)
+	BuildSegments(ctx context.Context, in SegmentInput) ([]Segment, error)
+}
+
+type songAPI interface {
+	FetchSongs(ctx context.Context, stationID string, window TimeRange) ([]Song, error)
 }
 
 type audioAPI interface {
-	DownloadAndMergeAacSegments(ctx context.Context, urls []string, outputDir, fileName string, onProgress func(done, total int)) (string, error)
+	DownloadAndMergeAacSegments(ctx context.Context, segs []Segment, outputDir, fileName string, opt MergeOptions) (AudioResult, error)
+	StreamAacSegments(ctx context.Context, segs []Segment, w io.Writer, opt MergeOptions) (AudioResult, error)
 }
 
 // Downloader orchestrates resolution, auth, playlist expansion, and audio merge.
@@ -46,6 +139,7 @@ type Downloader struct {
 	playlist      playlistAPI
 	auth          authAPI
 	audio         audioAPI
+	songs         songAPI
 }
 
 // NewDownloader wires the domain workflow with default concrete components.
@@ -59,6 +153,7 @@ func NewDownloader(net *netx.Client, concurrency int) *Downloader {
 		playlist: NewPlaylistBuilder(net),
 		auth:     NewAuthClient(net),
 		audio:    NewAudioDownloader(net, concurrency),
+		songs:    NewSongListResolver(net),
 	}
 }
 
@@ -69,39 +164,349 @@ func (d *Downloader) ResolveToDetailURL(ctx context.Context, raw string) (string
 
 // DownloadFromDetailURL executes the full timeshift workflow from a detail URL.
 // If AreaID is not provided, it is resolved from station metadata before auth.
-func (d *Downloader) DownloadFromDetailURL(ctx context.Context, detailURL string, opt DownloadOptions) (string, error) {
-	detail, err := ExtractDetailFromDetailURL(detailURL)
+// Programs already listed in opt.Archive return ErrAlreadyArchived. The result
+// compares the decoded audio length with the scheduled program length, or with
+// the length of opt.Range for clips.
+func (d *Downloader) DownloadFromDetailURL(ctx context.Context, detailURL string, opt DownloadOptions) (DownloadResult, error) {
+	return d.DownloadJoined(ctx, []string{detailURL}, opt)
+}
+
+// ListPrograms returns the programs in stationID's weekly schedule.
+func (d *Downloader) ListPrograms(ctx context.Context, stationID string) ([]ProgramMeta, error) {
+	return d.program.ListPrograms(ctx, stationID)
+}
+
+// ResolveSpan returns the detail URLs of every program on stationID that
+// overlaps span, in broadcast order.
+func (d *Downloader) ResolveSpan(ctx context.Context, stationID string, span TimeRange) ([]string, error) {
+	progs, err := d.program.ListPrograms(ctx, stationID)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	var out []string
+	for _, p := range progs {
+		if r := programRange(p); !r.IsZero() && r.From.Before(span.Until) && r.Until.After(span.From) {
+			out = append(out, fmt.Sprintf("https://radiko.jp/#!/ts/%s/%s", stationID, p.FT))
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no programs on %s between %s and %s", stationID, util.FormatTimestamp(span.From), util.FormatTimestamp(span.Until))
+	}
+	return out, nil
+}
+
+// DownloadJoined downloads consecutive programs of one station into a single
+// output named after the first program. Each program becomes an ID3 chapter,
+// and segments listed by two neighbouring programs are fetched once. The
+// programs must follow each other without a gap. The joined download is
+// skipped only when every program is archived, and opt.Range is only
+// supported for a single program.
+func (d *Downloader) DownloadJoined(ctx context.Context, detailURLs []string, opt DownloadOptions) (DownloadResult, error) {
+	if len(detailURLs) == 0 {
+		return DownloadResult{}, fmt.Errorf("no programs to download")
+	}
+	details := make([]DetailRef, len(detailURLs))
+	archived := true
+	for i, u := range detailURLs {
+		detail, err := ExtractDetailFromDetailURL(u)
+		if err != nil {
+			return DownloadResult{}, err
+		}
+		if i > 0 && detail.StationID != details[0].StationID {
+			return DownloadResult{}, fmt.Errorf("joined programs must share a station: %s and %s", details[0].StationID, detail.StationID)
+		}
+		details[i] = detail
+		archived = archived && opt.Archive.Has(detail.StationID, detail.FT)
+	}
+	detail := details[0]
+	clip := !opt.Range.IsZero()
+	stream := opt.Output != nil
+	if clip && len(details) > 1 {
+		return DownloadResult{}, fmt.Errorf("a range cannot be combined with joined programs")
+	}
+	// Check the archive first so skipped programs cost no auth or playlist work.
+	if !clip && !stream && archived {
+		return DownloadResult{}, ErrAlreadyArchived
 	}
 	areaID := opt.AreaID
+	var err error
 	if areaID == "" {
 		areaID, err = d.resolveAreaID(ctx, detail.StationID)
 		if err != nil {
-			return "", err
+			return DownloadResult{}, err
 		}
 	}
 	token, err := d.auth.RetrieveToken(ctx, areaID)
 	if err != nil {
-		return "", err
+		return DownloadResult{}, err
+	}
+	metas := make([]ProgramMeta, len(details))
+	for i, dt := range details {
+		if metas[i], err = d.program.ResolveProgramMeta(ctx, dt.StationID, dt.FT); err != nil {
+			return DownloadResult{}, err
+		}
+		if i > 0 && metas[i].FT != metas[i-1].TO {
+			return DownloadResult{}, fmt.Errorf("programs %s and %s are not consecutive", metas[i-1].FT, metas[i].FT)
+		}
+	}
+	meta := metas[0]
+	meta.TO = metas[len(metas)-1].TO
+	window := programRange(meta)
+	fileName := util.BuildProgramFileName(meta.Title, meta.FT)
+	var segWindow TimeRange
+	if clip {
+		if window, err = opt.Range.Resolve(window); err != nil {
+			return DownloadResult{}, err
+		}
+		fileName = clipFileName(fileName, window)
+		segWindow = window.Pad(opt.TrimPadding)
+	}
+	var segments []Segment
+	seen := map[string]bool{}
+	for _, m := range metas {
+		segs, err := d.playlist.BuildSegments(ctx, SegmentInput{
+			StationID: detail.StationID,
+			FT:        m.FT,
+			TO:        m.TO,
+			Token:     token,
+			AreaID:    areaID,
+			Window:    segWindow,
+		})
+		if err != nil {
+			return DownloadResult{}, err
+		}
+		for _, seg := range segs {
+			// Chunklists around a program boundary can list the same segment.
+			if !seen[seg.URL] {
+				seen[seg.URL] = true
+				segments = append(segments, seg)
+			}
+		}
+	}
+	if len(segments) == 0 {
+		return DownloadResult{}, fmt.Errorf("no segments found")
+	}
+	trim := window.Pad(opt.TrimPadding)
+	start := trim.From
+	if start.IsZero() {
+		start = segments[0].Start
+	}
+	var songs []Song
+	var warnings []string
+	if opt.SongList && d.songs != nil && !window.IsZero() {
+		// Fetched before the merge so single programs can embed the songs.
+		if songs, err = d.songs.FetchSongs(ctx, detail.StationID, window); err != nil {
+			warnings = append(warnings, fmt.Sprintf("song list unavailable: %v", err))
+		}
+	}
+	// Chapters are timed from start and carried into split parts.
+	var chapters []id3Chapter
+	if len(metas) > 1 {
+		chapters = programChapters(metas, start)
+	} else if len(songs) > 0 {
+		length := trim.Until.Sub(start)
+		chapters = songChapters(songTracks(songs, start, length), length)
+	}
+	var header []byte
+	if len(chapters) > 0 {
+		header = chapterTag(meta, chapters)
+	}
+	mergeOpt := MergeOptions{
+		OnProgress:    opt.OnProgress,
+		Window:        trim,
+		Header:        header,
+		BestEffort:    opt.BestEffort,
+		Retry:         opt.SegmentRetry,
+		Pool:          opt.Pool,
+		Concurrency:   opt.Concurrency,
+		OnConcurrency: opt.OnConcurrency,
+	}
+	var audio AudioResult
+	if stream {
+		audio, err = d.audio.StreamAacSegments(ctx, segments, opt.Output, mergeOpt)
+	} else {
+		audio, err = d.audio.DownloadAndMergeAacSegments(ctx, segments, opt.OutputDir, fileName, mergeOpt)
 	}
-	meta, err := d.program.ResolveProgramMeta(ctx, detail.StationID, detail.FT)
 	if err != nil {
-		return "", err
-	}
-	segmentURLs, err := d.playlist.BuildSegmentURLs(ctx, SegmentInput{
-		StationID: detail.StationID,
-		FT:        meta.FT,
-		TO:        meta.TO,
-		Token:     token,
-		AreaID:    areaID,
-	})
+		return DownloadResult{}, err
+	}
+	result := DownloadResult{Path: audio.Path, Expected: trim.Until.Sub(trim.From), Actual: audio.Stream.Duration, Gaps: audio.Gaps, Warnings: warnings}
+	result.Incomplete = result.Shortfall() > opt.CompletenessTolerance
+	if result.Incomplete && opt.FailIncomplete {
+		// Leave the file in place for inspection but keep it out of the
+		// manifest and archive so a later run retries the program.
+		return result, fmt.Errorf("%w: got %s, expected %s", ErrIncomplete, result.Actual, result.Expected)
+	}
+	if stream {
+		return result, nil
+	}
+	outputs := []AudioResult{audio}
+	if !opt.Split.IsZero() {
+		if outputs, err = splitAudio(audio, meta, chapters, trim, segments[0].Start, fileName, opt.Split); err != nil {
+			return DownloadResult{}, fmt.Errorf("split output: %w", err)
+		}
+		if len(outputs) > 1 {
+			result.Path = outputs[0].Path
+			for _, o := range outputs {
+				result.Parts = append(result.Parts, o.Path)
+			}
+		}
+	}
+	partStart := start
+	var joined []string
+	if len(details) > 1 {
+		for _, dt := range details {
+			joined = append(joined, dt.FT)
+		}
+	}
+	for i, out := range outputs {
+		rec := NewProgramRecord(detail, detailURLs[0], areaID, meta, out)
+		tracks := songTracks(songs, partStart, out.Stream.Duration)
+		partStart = partStart.Add(out.Stream.Duration)
+		if clip {
+			rec.ClipFrom, rec.ClipTo = util.FormatTimestamp(window.From), util.FormatTimestamp(window.Until)
+		}
+		if len(outputs) > 1 {
+			rec.Part, rec.Parts = i+1, len(outputs)
+		}
+		rec.Gaps = out.Gaps
+		if len(metas) > 1 {
+			for _, m := range metas {
+				rec.Chapters = append(rec.Chapters, ProgramChapter{Title: m.Title, FT: m.FT, TO: m.TO})
+			}
+		}
+		for _, t := range tracks {
+			rec.Songs = append(rec.Songs, t.Song)
+		}
+		if len(tracks) > 0 {
+			if _, err := WriteSongCue(out.Path, rec, tracks); err != nil {
+				return DownloadResult{}, fmt.Errorf("write cue sheet: %w", err)
+			}
+			if _, err := WriteSongTracklist(out.Path, tracks); err != nil {
+				return DownloadResult{}, fmt.Errorf("write tracklist: %w", err)
+			}
+		}
+		if opt.WriteInfoJSON {
+			if _, err := WriteSidecarJSON(out.Path, rec); err != nil {
+				return DownloadResult{}, fmt.Errorf("write info json: %w", err)
+			}
+		}
+		if opt.WriteNFO {
+			if _, err := WriteSidecarNFO(out.Path, rec); err != nil {
+				return DownloadResult{}, fmt.Errorf("write nfo: %w", err)
+			}
+		}
+		if err := RecordManifestEntry(filepath.Dir(out.Path), ManifestEntry{
+			File:      filepath.Base(out.Path),
+			SHA256:    out.SHA256,
+			Size:      out.Size,
+			Segments:  out.Segments,
+			StationID: detail.StationID,
+			FT:        detail.FT,
+			Joined:    joined,
+		}); err != nil {
+			return DownloadResult{}, fmt.Errorf("update manifest: %w", err)
+		}
+	}
+	if clip {
+		return result, nil
+	}
+	for _, dt := range details {
+		if err := opt.Archive.Add(dt.StationID, dt.FT); err != nil {
+			return DownloadResult{}, fmt.Errorf("update download archive: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// programChapters returns one chapter per joined program, timed from start,
+// the broadcast time of the first audio frame.
+func programChapters(programs []ProgramMeta, start time.Time) []id3Chapter {
+	chapters := make([]id3Chapter, 0, len(programs))
+	for _, p := range programs {
+		r := programRange(p)
+		c := id3Chapter{title: p.Title, start: r.From.Sub(start), end: r.Until.Sub(start)}
+		if c.start < 0 {
+			c.start = 0
+		}
+		chapters = append(chapters, c)
+	}
+	return chapters
+}
+
+// chapterTag returns an ID3 tag for meta with chapters, such as one per
+// joined program or one per song.
+func chapterTag(meta ProgramMeta, chapters []id3Chapter) []byte {
+	frames := []id3Frame{id3Text("TIT2", meta.Title), id3Text("TPE1", meta.Performer)}
+	return buildID3Tag(append(frames, id3Chapters(chapters)...)...)
+}
+
+// splitAudio cuts audio into parts per opt. The audio starts at window.From,
+// or at first when the window is unset. Each part's tag carries the chapters,
+// timed from the audio start, that overlap the part. A single-part result
+// leaves audio untouched.
+func splitAudio(audio AudioResult, meta ProgramMeta, chapters []id3Chapter, window TimeRange, first time.Time, fileName string, opt SplitOptions) ([]AudioResult, error) {
+	start := window.From
+	if start.IsZero() {
+		start = first
+	}
+	ft := programRange(meta).From
+	if ft.IsZero() {
+		ft = start
+	}
+	offsets := opt.cutOffsets(ft, start, audio.Stream.Duration)
+	if len(offsets) == 0 {
+		return []AudioResult{audio}, nil
+	}
+	parts, err := SplitADTSFile(audio.Path, offsets,
+		func(n, total int) string { return partFileName(fileName, n, total) },
+		func(n, total int) []byte {
+			from, until := time.Duration(0), audio.Stream.Duration
+			if n > 1 {
+				from = offsets[n-2]
+			}
+			if n <= len(offsets) {
+				until = offsets[n-1]
+			}
+			return partTag(meta, n, total, partChapters(chapters, from, until))
+		},
+	)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if len(segmentURLs) == 0 {
-		return "", fmt.Errorf("no segments found")
+	partStart := start
+	for i := range parts {
+		// Parts share the segment count of the whole download.
+		parts[i].Segments = audio.Segments
+		partEnd := partStart.Add(parts[i].Stream.Duration)
+		parts[i].Gaps = gapsWithin(audio.Gaps, TimeRange{From: partStart, Until: partEnd})
+		partStart = partEnd
 	}
-	fileName := util.BuildProgramFileName(meta.Title, meta.FT)
-	return d.audio.DownloadAndMergeAacSegments(ctx, segmentURLs, opt.OutputDir, fileName, opt.OnProgress)
+	return parts, nil
+}
+
+// gapsWithin returns the gaps whose silence overlaps r.
+func gapsWithin(gaps []Gap, r TimeRange) []Gap {
+	var out []Gap
+	for _, g := range gaps {
+		end := g.Start.Add(time.Duration(g.Seconds * float64(time.Second)))
+		if g.Start.Before(r.Until) && end.After(r.From) {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// programRange returns [ft, to) for meta, or an unset range when either
+// timestamp is malformed or the range is inverted.
+func programRange(meta ProgramMeta) TimeRange {
+	ft, err := util.ParseTimestamp(meta.FT)
+	if err != nil {
+		return TimeRange{}
+	}
+	to, err := util.ParseTimestamp(meta.TO)
+	if err != nil || to.Before(ft) {
+		return TimeRange{}
+	}
+	return TimeRange{From: ft, Until: to}
 }
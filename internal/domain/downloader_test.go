@@ -1,9 +1,18 @@
 package domain
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"rajidou/internal/util"
 )
 
 type fakeResolver struct {
@@ -33,40 +42,87 @@ func (f fakeAuth) RetrieveToken(ctx context.Context, areaID string) (string, err
 type fakeProgram struct {
 	meta ProgramMeta
 	err  error
+	// progs, when set, is the station schedule looked up by ft.
+	progs []ProgramMeta
 }
 
 func (f fakeProgram) ResolveProgramMeta(ctx context.Context, stationID, ft string) (ProgramMeta, error) {
 	if f.err != nil {
 		return ProgramMeta{}, f.err
 	}
+	for _, p := range f.progs {
+		if p.FT == ft {
+			return p, nil
+		}
+	}
 	return f.meta, nil
 }
 
+func (f fakeProgram) ListPrograms(ctx context.Context, stationID string) ([]ProgramMeta, error) {
+	return f.progs, f.err
+}
+
 type fakePlaylist struct {
 	urls []string
 	err  error
+	// byFT, when set, lists the segment URLs of each program by ft.
+	byFT map[string][]string
+	// input receives the segment request when non-nil.
+	input *SegmentInput
 }
 
-func (f fakePlaylist) BuildSegmentURLs(ctx context.Context, in SegmentInput) ([]string, error) {
+func (f fakePlaylist) BuildSegments(ctx context.Context, in SegmentInput) ([]Segment, error) {
 	if f.err != nil {
 		return nil, f.err
 	}
-	return f.urls, nil
+	if f.input != nil {
+		*f.input = in
+	}
+	if f.byFT != nil {
+		return testSegments(f.byFT[in.FT]...), nil
+	}
+	return testSegments(f.urls...), nil
 }
 
 type fakeAudio struct {
-	out string
-	err error
+	out    string
+	stream ADTSInfo
+	gaps   []Gap
+	err    error
+	// merge receives the merge options when non-nil.
+	merge *MergeOptions
 }
 
-func (f fakeAudio) DownloadAndMergeAacSegments(ctx context.Context, urls []string, outputDir, fileName string, onProgress func(done, total int)) (string, error) {
+func (f fakeAudio) DownloadAndMergeAacSegments(ctx context.Context, segs []Segment, outputDir, fileName string, opt MergeOptions) (AudioResult, error) {
 	if f.err != nil {
-		return "", f.err
+		return AudioResult{}, f.err
+	}
+	if opt.OnProgress != nil {
+		opt.OnProgress(len(segs), len(segs))
 	}
-	if onProgress != nil {
-		onProgress(len(urls), len(urls))
+	if f.merge != nil {
+		*f.merge = opt
 	}
-	return f.out, nil
+	out := f.out
+	if out == "" {
+		out = filepath.Join(outputDir, fileName)
+	}
+	return AudioResult{Path: out, Segments: len(segs), Stream: f.stream, Gaps: f.gaps}, nil
+}
+
+func (f fakeAudio) StreamAacSegments(ctx context.Context, segs []Segment, w io.Writer, opt MergeOptions) (AudioResult, error) {
+	if f.err != nil {
+		return AudioResult{}, f.err
+	}
+	if f.merge != nil {
+		*f.merge = opt
+	}
+	for _, s := range segs {
+		if _, err := io.WriteString(w, s.URL); err != nil {
+			return AudioResult{}, err
+		}
+	}
+	return AudioResult{Segments: len(segs), Stream: f.stream}, nil
 }
 
 func TestDownloaderResolvePassThrough(t *testing.T) {
@@ -86,14 +142,285 @@ func TestDownloaderDownloadFromDetailURLSuccessWithGivenArea(t *testing.T) {
 		auth:     fakeAuth{token: "tok"},
 		program:  fakeProgram{meta: ProgramMeta{FT: "20260101000000", TO: "20260101050000", Title: "T"}},
 		playlist: fakePlaylist{urls: []string{"u1", "u2"}},
-		audio:    fakeAudio{out: "out.aac"},
+		audio:    fakeAudio{},
+	}
+	dir := t.TempDir()
+	got, err := d.DownloadFromDetailURL(context.Background(), "https://radiko.jp/#!/ts/AAA/20260101000000", DownloadOptions{AreaID: "JP1", OutputDir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filepath.Dir(got.Path) != dir {
+		t.Fatalf("want output in %s, got %s", dir, got.Path)
+	}
+}
+
+func TestDownloaderDownloadFromDetailURLWritesSidecars(t *testing.T) {
+	d := &Downloader{
+		auth: fakeAuth{token: "tok"},
+		program: fakeProgram{meta: ProgramMeta{
+			FT: "20260101000000", TO: "20260101013000", Title: "T", Performer: "A、B", Description: "desc",
+		}},
+		playlist: fakePlaylist{urls: []string{"u1", "u2"}},
+		audio:    fakeAudio{},
+	}
+	dir := t.TempDir()
+	got, err := d.DownloadFromDetailURL(context.Background(), "https://radiko.jp/#!/ts/AAA/20260101000000", DownloadOptions{
+		AreaID: "JP13", OutputDir: dir, WriteInfoJSON: true, WriteNFO: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	raw, err := os.ReadFile(SidecarPath(got.Path, ".json"))
+	if err != nil {
+		t.Fatalf("read json sidecar: %v", err)
+	}
+	var rec ProgramRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		t.Fatalf("decode json sidecar: %v", err)
+	}
+	if rec.StationID != "AAA" || rec.TO != "20260101013000" || rec.AreaID != "JP13" || rec.Segments != 2 {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+
+	nfo, err := os.ReadFile(SidecarPath(got.Path, ".nfo"))
+	if err != nil {
+		t.Fatalf("read nfo sidecar: %v", err)
+	}
+	for _, want := range []string{"<episodedetails>", "<runtime>90</runtime>", "<name>B</name>", "<aired>2026-01-01</aired>"} {
+		if !strings.Contains(string(nfo), want) {
+			t.Fatalf("nfo missing %q: %s", want, nfo)
+		}
+	}
+}
+
+func TestDownloaderDownloadFromDetailURLSkipsArchivedBeforeAuth(t *testing.T) {
+	archive, err := LoadDownloadArchive(filepath.Join(t.TempDir(), "archive.txt"))
+	if err != nil {
+		t.Fatalf("load archive: %v", err)
+	}
+	d := &Downloader{
+		auth:     fakeAuth{token: "tok"},
+		program:  fakeProgram{meta: ProgramMeta{FT: "20260101000000", TO: "20260101010000", Title: "T"}},
+		playlist: fakePlaylist{urls: []string{"u1"}},
+		audio:    fakeAudio{},
+	}
+	opt := DownloadOptions{AreaID: "JP1", OutputDir: t.TempDir(), Archive: archive}
+	if _, err := d.DownloadFromDetailURL(context.Background(), "https://radiko.jp/#!/ts/AAA/20260101000000", opt); err != nil {
+		t.Fatalf("first download: %v", err)
+	}
+	d.auth = fakeAuth{err: errors.New("auth must not be called")}
+	if _, err := d.DownloadFromDetailURL(context.Background(), "https://radiko.jp/#!/ts/AAA/20260101000000", opt); !errors.Is(err, ErrAlreadyArchived) {
+		t.Fatalf("want ErrAlreadyArchived, got %v", err)
+	}
+}
+
+func TestDownloaderDownloadFromDetailURLFlagsIncompleteAudio(t *testing.T) {
+	d := &Downloader{
+		auth:     fakeAuth{token: "tok"},
+		program:  fakeProgram{meta: ProgramMeta{FT: "20260101000000", TO: "20260101010000", Title: "T"}},
+		playlist: fakePlaylist{urls: []string{"u1"}},
+		audio:    fakeAudio{stream: ADTSInfo{Duration: 55 * time.Minute}},
+	}
+	url := "https://radiko.jp/#!/ts/AAA/20260101000000"
+	opt := DownloadOptions{AreaID: "JP1", OutputDir: t.TempDir(), CompletenessTolerance: 10 * time.Second}
+	got, err := d.DownloadFromDetailURL(context.Background(), url, opt)
+	if err != nil {
+		t.Fatalf("warn mode should succeed: %v", err)
+	}
+	if !got.Incomplete || got.Expected != time.Hour || got.Shortfall() != 5*time.Minute {
+		t.Fatalf("unexpected result: %+v", got)
+	}
+
+	opt.FailIncomplete = true
+	if _, err := d.DownloadFromDetailURL(context.Background(), url, opt); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("want ErrIncomplete, got %v", err)
+	}
+
+	opt.CompletenessTolerance = 10 * time.Minute
+	if got, err := d.DownloadFromDetailURL(context.Background(), url, opt); err != nil || got.Incomplete {
+		t.Fatalf("shortfall within tolerance should pass: %+v %v", got, err)
+	}
+}
+
+func TestDownloaderDownloadFromDetailURLJudgesCompletenessOnPaddedAudio(t *testing.T) {
+	d := &Downloader{
+		auth:     fakeAuth{token: "tok"},
+		program:  fakeProgram{meta: ProgramMeta{FT: "20260101000000", TO: "20260101010000", Title: "T"}},
+		playlist: fakePlaylist{urls: []string{"u1"}},
+		audio:    fakeAudio{stream: ADTSInfo{Duration: time.Hour}},
+	}
+	url := "https://radiko.jp/#!/ts/AAA/20260101000000"
+	opt := DownloadOptions{AreaID: "JP1", OutputDir: t.TempDir(), TrimPadding: 30 * time.Second, CompletenessTolerance: 10 * time.Second}
+	got, err := d.DownloadFromDetailURL(context.Background(), url, opt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Incomplete || got.Expected != time.Hour+time.Minute || got.Shortfall() != time.Minute {
+		t.Fatalf("missing padding must count as a shortfall: %+v", got)
+	}
+
+	d.audio = fakeAudio{stream: ADTSInfo{Duration: time.Hour + time.Minute}, gaps: []Gap{{Index: 3, Seconds: 20}}}
+	got, err = d.DownloadFromDetailURL(context.Background(), url, opt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Incomplete || got.Shortfall() != 20*time.Second {
+		t.Fatalf("filled gaps must count as a shortfall: %+v", got)
+	}
+}
+
+func TestDownloaderDownloadFromDetailURLTrimsToProgramWithPadding(t *testing.T) {
+	var merge MergeOptions
+	d := &Downloader{
+		auth:     fakeAuth{token: "tok"},
+		program:  fakeProgram{meta: ProgramMeta{FT: "20260101000000", TO: "20260101010000", Title: "T"}},
+		playlist: fakePlaylist{urls: []string{"u1"}},
+		audio:    fakeAudio{merge: &merge},
+	}
+	opt := DownloadOptions{AreaID: "JP1", OutputDir: t.TempDir(), TrimPadding: 5 * time.Second}
+	if _, err := d.DownloadFromDetailURL(context.Background(), "https://radiko.jp/#!/ts/AAA/20260101000000", opt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ft := time.Date(2026, 1, 1, 0, 0, 0, 0, util.Tokyo)
+	if window := merge.Window; !window.From.Equal(ft.Add(-5*time.Second)) || !window.Until.Equal(ft.Add(time.Hour+5*time.Second)) {
+		t.Fatalf("unexpected window: %+v", window)
+	}
+}
+
+func TestDownloaderDownloadFromDetailURLClipsRange(t *testing.T) {
+	var in SegmentInput
+	var merge MergeOptions
+	archive, err := LoadDownloadArchive(filepath.Join(t.TempDir(), "archive.txt"))
+	if err != nil {
+		t.Fatalf("load archive: %v", err)
+	}
+	d := &Downloader{
+		auth:     fakeAuth{token: "tok"},
+		program:  fakeProgram{meta: ProgramMeta{FT: "20260101000000", TO: "20260101030000", Title: "T"}},
+		playlist: fakePlaylist{urls: []string{"u1"}, input: &in},
+		audio:    fakeAudio{merge: &merge},
+	}
+	rng, err := ParseRangeSpec("+00:45:00..+01:10:00")
+	if err != nil {
+		t.Fatalf("parse range: %v", err)
+	}
+	opt := DownloadOptions{AreaID: "JP1", OutputDir: t.TempDir(), Archive: archive, Range: rng, WriteInfoJSON: true}
+	got, err := d.DownloadFromDetailURL(context.Background(), "https://radiko.jp/#!/ts/AAA/20260101000000", opt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ft := time.Date(2026, 1, 1, 0, 0, 0, 0, util.Tokyo)
+	want := TimeRange{From: ft.Add(45 * time.Minute), Until: ft.Add(70 * time.Minute)}
+	if in.Window != want || merge.Window != want {
+		t.Fatalf("unexpected windows: segments %+v, trim %+v", in.Window, merge.Window)
+	}
+	if in.FT != "20260101000000" || in.TO != "20260101030000" {
+		t.Fatalf("playlist must still see the whole program: %+v", in)
+	}
+	if got.Expected != 25*time.Minute || !strings.HasSuffix(got.Path, "(004500-011000).aac") {
+		t.Fatalf("unexpected result: %+v", got)
+	}
+	raw, err := os.ReadFile(SidecarPath(got.Path, ".json"))
+	if err != nil {
+		t.Fatalf("read sidecar: %v", err)
+	}
+	var rec ProgramRecord
+	if err := json.Unmarshal(raw, &rec); err != nil || rec.ClipFrom != "20260101004500" || rec.ClipTo != "20260101011000" {
+		t.Fatalf("unexpected sidecar: %s (%v)", raw, err)
+	}
+	if archive.Has("AAA", "20260101000000") {
+		t.Fatal("a clip must not archive the whole program")
+	}
+}
+
+func TestDownloaderDownloadJoinedMergesConsecutivePrograms(t *testing.T) {
+	var merge MergeOptions
+	archive, err := LoadDownloadArchive(filepath.Join(t.TempDir(), "archive.txt"))
+	if err != nil {
+		t.Fatalf("load archive: %v", err)
+	}
+	d := &Downloader{
+		auth: fakeAuth{token: "tok"},
+		program: fakeProgram{progs: []ProgramMeta{
+			{FT: "20260101200000", TO: "20260101210000", Title: "Show Part 1"},
+			{FT: "20260101210000", TO: "20260101220000", Title: "Show Part 2"},
+		}},
+		playlist: fakePlaylist{byFT: map[string][]string{
+			"20260101200000": {"a", "b", "c"},
+			// The first segment of part 2 repeats the last one of part 1.
+			"20260101210000": {"c", "d"},
+		}},
+		audio: fakeAudio{merge: &merge},
+	}
+	opt := DownloadOptions{AreaID: "JP1", OutputDir: t.TempDir(), Archive: archive, WriteInfoJSON: true}
+	got, err := d.DownloadJoined(context.Background(), []string{
+		"https://radiko.jp/#!/ts/AAA/20260101200000",
+		"https://radiko.jp/#!/ts/AAA/20260101210000",
+	}, opt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Expected != 2*time.Hour {
+		t.Fatalf("want 2h expected, got %s", got.Expected)
+	}
+	if !bytes.Contains(merge.Header, []byte("CTOC")) || bytes.Count(merge.Header, []byte("CHAP")) != 2 {
+		t.Fatalf("missing chapter frames in header: %q", merge.Header)
 	}
-	got, err := d.DownloadFromDetailURL(context.Background(), "https://radiko.jp/#!/ts/AAA/20260101000000", DownloadOptions{AreaID: "JP1", OutputDir: t.TempDir()})
+	raw, err := os.ReadFile(SidecarPath(got.Path, ".json"))
+	if err != nil {
+		t.Fatalf("read sidecar: %v", err)
+	}
+	var rec ProgramRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		t.Fatalf("decode sidecar: %v", err)
+	}
+	if rec.Segments != 4 || rec.TO != "20260101220000" || len(rec.Chapters) != 2 || rec.Chapters[1].Title != "Show Part 2" {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+	manifest, err := LoadManifest(filepath.Dir(got.Path))
+	if err != nil {
+		t.Fatalf("load manifest: %v", err)
+	}
+	if m := manifest[filepath.Base(got.Path)]; m.FT != "20260101200000" || len(m.Joined) != 2 || m.Joined[1] != "20260101210000" {
+		t.Fatalf("manifest must list every joined program: %+v", m)
+	}
+	if !archive.Has("AAA", "20260101200000") || !archive.Has("AAA", "20260101210000") {
+		t.Fatal("every joined program should be archived")
+	}
+}
+
+func TestDownloaderDownloadJoinedRejectsGaps(t *testing.T) {
+	d := &Downloader{
+		auth: fakeAuth{token: "tok"},
+		program: fakeProgram{progs: []ProgramMeta{
+			{FT: "20260101200000", TO: "20260101210000", Title: "A"},
+			{FT: "20260101213000", TO: "20260101220000", Title: "B"},
+		}},
+	}
+	_, err := d.DownloadJoined(context.Background(), []string{
+		"https://radiko.jp/#!/ts/AAA/20260101200000",
+		"https://radiko.jp/#!/ts/AAA/20260101213000",
+	}, DownloadOptions{AreaID: "JP1", OutputDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "not consecutive") {
+		t.Fatalf("want consecutive error, got %v", err)
+	}
+}
+
+func TestDownloaderResolveSpan(t *testing.T) {
+	d := &Downloader{program: fakeProgram{progs: []ProgramMeta{
+		{FT: "20260101190000", TO: "20260101200000"},
+		{FT: "20260101200000", TO: "20260101210000"},
+		{FT: "20260101210000", TO: "20260101220000"},
+		{FT: "20260101220000", TO: "20260101230000"},
+	}}}
+	ft := time.Date(2026, 1, 1, 20, 0, 0, 0, util.Tokyo)
+	got, err := d.ResolveSpan(context.Background(), "AAA", TimeRange{From: ft, Until: ft.Add(2 * time.Hour)})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if got != "out.aac" {
-		t.Fatalf("want out.aac, got %s", got)
+	if len(got) != 2 || got[0] != "https://radiko.jp/#!/ts/AAA/20260101200000" || got[1] != "https://radiko.jp/#!/ts/AAA/20260101210000" {
+		t.Fatalf("unexpected programs: %v", got)
 	}
 }
 
@@ -132,3 +459,104 @@ func TestDownloaderDownloadFromDetailURLPropagatesErrors(t *testing.T) {
 		})
 	}
 }
+
+type fakeSongs struct {
+	songs []Song
+	err   error
+}
+
+func (f fakeSongs) FetchSongs(ctx context.Context, stationID string, window TimeRange) ([]Song, error) {
+	return f.songs, f.err
+}
+
+func TestDownloaderWritesSongList(t *testing.T) {
+	var merge MergeOptions
+	ft := time.Date(2026, 1, 1, 20, 0, 0, 0, util.Tokyo)
+	d := &Downloader{
+		auth:     fakeAuth{token: "tok"},
+		program:  fakeProgram{meta: ProgramMeta{FT: "20260101200000", TO: "20260101210000", Title: "Show"}},
+		playlist: fakePlaylist{urls: []string{"u1"}},
+		audio:    fakeAudio{merge: &merge, stream: ADTSInfo{Duration: time.Hour}},
+		songs: fakeSongs{songs: []Song{
+			{Title: "One", Artist: "A", Start: ft.Add(5 * time.Minute)},
+			{Title: "Two", Start: ft.Add(30 * time.Minute)},
+		}},
+	}
+	got, err := d.DownloadFromDetailURL(context.Background(), "https://radiko.jp/#!/ts/AAA/20260101200000", DownloadOptions{
+		AreaID: "JP1", OutputDir: t.TempDir(), SongList: true, WriteInfoJSON: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bytes.Count(merge.Header, []byte("CHAP")) != 2 {
+		t.Fatalf("songs should be embedded as chapters: %q", merge.Header)
+	}
+	cue, err := os.ReadFile(SidecarPath(got.Path, ".cue"))
+	if err != nil {
+		t.Fatalf("read cue: %v", err)
+	}
+	if !strings.Contains(string(cue), "TRACK 03 AUDIO\n    TITLE \"Two\"\n    INDEX 01 30:00:00") {
+		t.Fatalf("unexpected cue sheet:\n%s", cue)
+	}
+	list, err := os.ReadFile(SidecarPath(got.Path, ".tracklist.txt"))
+	if err != nil || string(list) != "00:05:00 [20:05:00] A - One\n00:30:00 [20:30:00] Two\n" {
+		t.Fatalf("unexpected tracklist: %q %v", list, err)
+	}
+	raw, _ := os.ReadFile(SidecarPath(got.Path, ".json"))
+	var rec ProgramRecord
+	if err := json.Unmarshal(raw, &rec); err != nil || len(rec.Songs) != 2 {
+		t.Fatalf("sidecar should list songs: %+v %v", rec, err)
+	}
+}
+
+func TestDownloaderSongListFailureIsAWarning(t *testing.T) {
+	d := &Downloader{
+		auth:     fakeAuth{token: "tok"},
+		program:  fakeProgram{meta: ProgramMeta{FT: "20260101200000", TO: "20260101210000", Title: "Show"}},
+		playlist: fakePlaylist{urls: []string{"u1"}},
+		audio:    fakeAudio{stream: ADTSInfo{Duration: time.Hour}},
+		songs:    fakeSongs{err: errors.New("boom")},
+	}
+	got, err := d.DownloadFromDetailURL(context.Background(), "https://radiko.jp/#!/ts/AAA/20260101200000", DownloadOptions{
+		AreaID: "JP1", OutputDir: t.TempDir(), SongList: true,
+	})
+	if err != nil {
+		t.Fatalf("song list failure must not fail the download: %v", err)
+	}
+	if len(got.Warnings) != 1 {
+		t.Fatalf("want one warning, got %v", got.Warnings)
+	}
+	if _, err := os.Stat(SidecarPath(got.Path, ".cue")); !os.IsNotExist(err) {
+		t.Fatalf("no cue sheet expected: %v", err)
+	}
+}
+
+func TestDownloaderStreamsToOutput(t *testing.T) {
+	archive, err := LoadDownloadArchive(filepath.Join(t.TempDir(), "archive.txt"))
+	if err != nil {
+		t.Fatalf("load archive: %v", err)
+	}
+	if err := archive.Add("AAA", "20260101200000"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	d := &Downloader{
+		auth:     fakeAuth{token: "tok"},
+		program:  fakeProgram{meta: ProgramMeta{FT: "20260101200000", TO: "20260101210000", Title: "Show"}},
+		playlist: fakePlaylist{urls: []string{"u1", "u2"}},
+		audio:    fakeAudio{stream: ADTSInfo{Duration: time.Hour}},
+	}
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	got, err := d.DownloadFromDetailURL(context.Background(), "https://radiko.jp/#!/ts/AAA/20260101200000", DownloadOptions{
+		AreaID: "JP1", OutputDir: dir, Output: &buf, Archive: archive, WriteInfoJSON: true,
+	})
+	if err != nil {
+		t.Fatalf("archived programs must still stream: %v", err)
+	}
+	if buf.String() != "u1u2" || got.Path != "" || got.Actual != time.Hour {
+		t.Fatalf("unexpected stream result: %q %+v", buf.String(), got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("streaming must not write files: %v", entries)
+	}
+}
@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Source map in this file:
+//   - ID3v2.4 tag layout follows the id3.org v2.4 structure and frames
+//     documents; tagging output files is CLI-specific.
+//
+// id3Frame is one raw ID3v2.4 frame body with its four-character ID.
+type id3Frame struct {
+	id   string
+	body []byte
+}
+
+// id3Text returns a UTF-8 text information frame such as TIT2 or TRCK.
+func id3Text(id, value string) id3Frame {
+	return id3Frame{id: id, body: append([]byte{0x03}, value...)}
+}
+
+// buildID3Tag serializes frames into an ID3v2.4 tag. Frames with an empty
+// text value are left out.
+func buildID3Tag(frames ...id3Frame) []byte {
+	body := encodeID3Frames(frames)
+	out := make([]byte, 0, 10+len(body))
+	out = append(out, 'I', 'D', '3', 4, 0, 0)
+	out = append(out, syncsafe(len(body))...)
+	return append(out, body...)
+}
+
+func encodeID3Frames(frames []id3Frame) []byte {
+	var body bytes.Buffer
+	for _, f := range frames {
+		if f.id[0] == 'T' && len(f.body) <= 1 {
+			continue
+		}
+		body.WriteString(f.id)
+		body.Write(syncsafe(len(f.body)))
+		// No frame flags.
+		body.Write([]byte{0, 0})
+		body.Write(f.body)
+	}
+	return body.Bytes()
+}
+
+// id3Chapter is one chapter marker, timed from the start of the audio.
+type id3Chapter struct {
+	title      string
+	start, end time.Duration
+}
+
+// maxID3Chapters is the most entries a CTOC frame can count in its one-byte
+// entry count.
+const maxID3Chapters = 255
+
+// id3Chapters returns an ordered top-level table of contents (CTOC) and one
+// CHAP frame per chapter, following the ID3v2 chapter frame addendum.
+// Chapters past maxID3Chapters are dropped.
+func id3Chapters(chapters []id3Chapter) []id3Frame {
+	if len(chapters) > maxID3Chapters {
+		chapters = chapters[:maxID3Chapters]
+	}
+	toc := []byte{'t', 'o', 'c', 0, 0x03, byte(len(chapters))}
+	frames := make([]id3Frame, 0, len(chapters)+1)
+	for i, c := range chapters {
+		id := fmt.Sprintf("chp%d", i)
+		toc = append(append(toc, id...), 0)
+		body := append([]byte(id), 0)
+		body = binary.BigEndian.AppendUint32(body, uint32(c.start.Milliseconds()))
+		body = binary.BigEndian.AppendUint32(body, uint32(c.end.Milliseconds()))
+		// Byte offsets are unused; times locate the chapter.
+		body = binary.BigEndian.AppendUint32(body, 0xFFFFFFFF)
+		body = binary.BigEndian.AppendUint32(body, 0xFFFFFFFF)
+		body = append(body, encodeID3Frames([]id3Frame{id3Text("TIT2", c.title)})...)
+		frames = append(frames, id3Frame{id: "CHAP", body: body})
+	}
+	return append([]id3Frame{{id: "CTOC", body: toc}}, frames...)
+}
+
+// id3StableFrames returns the frames of tag without its chapter frames,
+// which are rebuilt from live song lists and may change between runs. Input
+// that is not a well-formed ID3v2 tag is returned unchanged.
+func id3StableFrames(tag []byte) []byte {
+	size := ParseAACPackedHeaderSize(tag)
+	if size == 0 || size > len(tag) {
+		return tag
+	}
+	var out []byte
+	for body := tag[10:size]; len(body) >= 10 && body[0] != 0; {
+		n := 10 + (int(body[4])<<21 | int(body[5])<<14 | int(body[6])<<7 | int(body[7]))
+		if n > len(body) {
+			return tag
+		}
+		if id := string(body[:4]); id != "CTOC" && id != "CHAP" {
+			out = append(out, body[:n]...)
+		}
+		body = body[n:]
+	}
+	return out
+}
+
+// syncsafe encodes n as a 4-byte ID3v2 synchsafe integer (7 bits per byte).
+func syncsafe(n int) []byte {
+	return []byte{byte(n>>21) & 0x7F, byte(n>>14) & 0x7F, byte(n>>7) & 0x7F, byte(n) & 0x7F}
+}
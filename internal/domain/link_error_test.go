@@ -3,6 +3,8 @@ package domain
 import (
 	"testing"
 	"time"
+
+	"rajidou/internal/util"
 )
 
 func TestExtractDetailFromDetailURLInvalid(t *testing.T) {
@@ -13,7 +15,7 @@ func TestExtractDetailFromDetailURLInvalid(t *testing.T) {
 }
 
 func TestPickLatestDetailURLNoUsableEntry(t *testing.T) {
-	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, util.Tokyo)
 	_, err := PickLatestDetailURL([]string{"https://radiko.jp/#!/ts/AAA/20270201000000"}, now)
 	if err == nil {
 		t.Fatal("expected error")
@@ -3,6 +3,8 @@ package domain
 import (
 	"testing"
 	"time"
+
+	"rajidou/internal/util"
 )
 
 func TestClassifyRadikoLink(t *testing.T) {
@@ -29,7 +31,7 @@ func TestExtractDetailFromDetailURL(t *testing.T) {
 }
 
 func TestPickLatestDetailURL(t *testing.T) {
-	now := time.Date(2026, 2, 20, 0, 0, 0, 0, time.Local)
+	now := time.Date(2026, 2, 20, 0, 0, 0, 0, util.Tokyo)
 	links := []string{
 		"https://radiko.jp/#!/ts/ALPHA-STATION/20260217000000",
 		"https://radiko.jp/#!/ts/ALPHA-STATION/20260218000000",
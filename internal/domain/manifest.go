@@ -0,0 +1,170 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"rajidou/internal/util"
+)
+
+// Source map in this file:
+//   - checksum manifest and verification are CLI-specific archive integrity
+//     features with no Rajiko counterpart.
+//
+// ManifestFileName is the checksum manifest kept in each output directory.
+const ManifestFileName = "rajidou-manifest.json"
+
+// ManifestEntry records the integrity data of one completed download.
+type ManifestEntry struct {
+	File      string `json:"file"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	Segments  int    `json:"segments"`
+	StationID string `json:"station,omitempty"`
+	FT        string `json:"ft,omitempty"`
+	// Joined lists the FT of every program of a joined download, FT first.
+	Joined []string `json:"joined,omitempty"`
+}
+
+// manifestMu serializes read-modify-write cycles so concurrent jobs writing to
+// the same output directory do not drop each other's entries.
+var manifestMu sync.Mutex
+
+// LoadManifest reads the manifest in dir keyed by file name. A missing
+// manifest yields an empty map.
+func LoadManifest(dir string) (map[string]ManifestEntry, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]ManifestEntry{}, nil
+		}
+		return nil, err
+	}
+	var list []ManifestEntry
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	out := make(map[string]ManifestEntry, len(list))
+	for _, e := range list {
+		out[e.File] = e
+	}
+	return out, nil
+}
+
+// RecordManifestEntry adds or replaces e in the manifest in dir.
+func RecordManifestEntry(dir string, e ManifestEntry) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	entries, err := LoadManifest(dir)
+	if err != nil {
+		return err
+	}
+	entries[e.File] = e
+	list := make([]ManifestEntry, 0, len(entries))
+	for _, v := range entries {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].File < list[j].File })
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(filepath.Join(dir, ManifestFileName), append(b, '\n'), 0o644)
+}
+
+// VerifyStatus classifies a manifest entry after re-checking its file.
+type VerifyStatus string
+
+const (
+	// VerifyOK means size and checksum match and the ADTS stream is intact.
+	VerifyOK VerifyStatus = "ok"
+	// VerifyMissing means the file no longer exists.
+	VerifyMissing VerifyStatus = "missing"
+	// VerifyTruncated means the file is shorter than recorded.
+	VerifyTruncated VerifyStatus = "truncated"
+	// VerifyModified means the size or checksum differs from the record.
+	VerifyModified VerifyStatus = "modified"
+	// VerifyCorrupt means the checksum matches but the ADTS stream is damaged.
+	VerifyCorrupt VerifyStatus = "corrupt"
+)
+
+// VerifyResult is the outcome of checking one manifest entry.
+type VerifyResult struct {
+	Entry  ManifestEntry
+	Status VerifyStatus
+	Detail string
+}
+
+// VerifyDir re-hashes every file listed in the manifest in dir and walks its
+// ADTS frames. Results are ordered by file name.
+func VerifyDir(dir string) ([]VerifyResult, error) {
+	entries, err := LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]VerifyResult, 0, len(names))
+	for _, name := range names {
+		r, err := verifyEntry(filepath.Join(dir, name), entries[name])
+		if err != nil {
+			return out, err
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func verifyEntry(path string, e ManifestEntry) (VerifyResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return VerifyResult{Entry: e, Status: VerifyMissing}, nil
+		}
+		return VerifyResult{}, err
+	}
+	defer f.Close()
+	// Hash and frame-walk in one pass so large archives are read only once.
+	h := sha256.New()
+	cr := &countingReader{r: io.TeeReader(f, h)}
+	_, scanErr := ScanADTSFrames(cr)
+	if _, err := io.Copy(io.Discard, cr); err != nil {
+		return VerifyResult{}, err
+	}
+	size := cr.n
+	sum := hex.EncodeToString(h.Sum(nil))
+	switch {
+	case size < e.Size:
+		return VerifyResult{Entry: e, Status: VerifyTruncated, Detail: sizeDetail(size, e.Size)}, nil
+	case size != e.Size || sum != e.SHA256:
+		return VerifyResult{Entry: e, Status: VerifyModified, Detail: sizeDetail(size, e.Size)}, nil
+	case scanErr != nil:
+		return VerifyResult{Entry: e, Status: VerifyCorrupt, Detail: scanErr.Error()}, nil
+	}
+	return VerifyResult{Entry: e, Status: VerifyOK}, nil
+}
+
+func sizeDetail(got, want int64) string {
+	return fmt.Sprintf("size %d, recorded %d", got, want)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
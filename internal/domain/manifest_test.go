@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeManifestFixture(t *testing.T, dir, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	sum := sha256.Sum256(data)
+	if err := RecordManifestEntry(dir, ManifestEntry{File: name, SHA256: hex.EncodeToString(sum[:]), Size: int64(len(data)), Segments: 1}); err != nil {
+		t.Fatalf("record %s: %v", name, err)
+	}
+}
+
+func TestVerifyDirClassifiesEntries(t *testing.T) {
+	dir := t.TempDir()
+	good := testADTSStream(4)
+	writeManifestFixture(t, dir, "a-ok.aac", good)
+	writeManifestFixture(t, dir, "b-missing.aac", good)
+	writeManifestFixture(t, dir, "c-truncated.aac", good)
+	writeManifestFixture(t, dir, "d-modified.aac", good)
+	writeManifestFixture(t, dir, "e-corrupt.aac", append(append([]byte{}, good...), 0x00))
+
+	_ = os.Remove(filepath.Join(dir, "b-missing.aac"))
+	_ = os.WriteFile(filepath.Join(dir, "c-truncated.aac"), good[:len(good)-3], 0o644)
+	modified := append([]byte{}, good...)
+	modified[8] ^= 0xFF
+	_ = os.WriteFile(filepath.Join(dir, "d-modified.aac"), modified, 0o644)
+
+	results, err := VerifyDir(dir)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	want := []VerifyStatus{VerifyOK, VerifyMissing, VerifyTruncated, VerifyModified, VerifyCorrupt}
+	if len(results) != len(want) {
+		t.Fatalf("want %d results, got %d", len(want), len(results))
+	}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Fatalf("%s: want %s, got %s (%s)", r.Entry.File, want[i], r.Status, r.Detail)
+		}
+	}
+}
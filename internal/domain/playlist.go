@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"rajidou/internal/netx"
 	"rajidou/internal/util"
@@ -25,7 +27,7 @@ func NewPlaylistBuilder(net *netx.Client) *PlaylistBuilder {
 
 func (p *PlaylistBuilder) playlistCreateURL(ctx context.Context, stationID string) (string, error) {
 	url := fmt.Sprintf("https://radiko.jp/v3/station/stream/pc_html5/%s.xml", stationID)
-	status, xml, err := p.net.GetText(ctx, url, nil)
+	status, xml, err := p.net.GetText(netx.WithCache(ctx), url, nil)
 	if err != nil {
 		return "", err
 	}
@@ -49,23 +51,78 @@ type SegmentInput struct {
 	TO        string
 	Token     string
 	AreaID    string
+	// Window, when set, restricts the request to the seek windows and
+	// segments overlapping it. FT and TO still describe the whole program.
+	Window TimeRange
+}
+
+// Segment is one media segment with its position on the broadcast timeline.
+type Segment struct {
+	URL      string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// overlaps reports whether s plays during any part of r. A segment without a
+// known duration counts by its start time alone.
+func (s Segment) overlaps(r TimeRange) bool {
+	if s.Duration <= 0 {
+		return r.Contains(s.Start)
+	}
+	end := s.Start.Add(s.Duration)
+	return (r.From.IsZero() || end.After(r.From)) && (r.Until.IsZero() || s.Start.Before(r.Until))
+}
+
+// SegmentURLs returns the URLs of segs in order.
+func SegmentURLs(segs []Segment) []string {
+	out := make([]string, len(segs))
+	for i, s := range segs {
+		out[i] = s.URL
+	}
+	return out
 }
 
 // BuildSegmentURLs iterates seek windows between FT and TO and collects media
 // segment URLs from each chunklist response.
 func (p *PlaylistBuilder) BuildSegmentURLs(ctx context.Context, in SegmentInput) ([]string, error) {
+	segs, err := p.BuildSegments(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return SegmentURLs(segs), nil
+}
+
+// BuildSegments iterates seek windows between FT and TO and collects media
+// segments from each chunklist response. Segment start times come from
+// #EXT-X-PROGRAM-DATE-TIME when present; otherwise each chunklist is taken to
+// start at its seek time and advance by #EXTINF durations.
+func (p *PlaylistBuilder) BuildSegments(ctx context.Context, in SegmentInput) ([]Segment, error) {
 	const fixedSeek = 300
 	base, err := p.playlistCreateURL(ctx, in.StationID)
 	if err != nil {
 		return nil, err
 	}
 
-	links := make([]string, 0, 1024)
+	links := make([]Segment, 0, 1024)
 	seek := in.FT
 	endDate, err := util.ParseTimestamp(in.TO)
 	if err != nil {
 		return nil, err
 	}
+	if !in.Window.IsZero() {
+		ftDate, err := util.ParseTimestamp(in.FT)
+		if err != nil {
+			return nil, err
+		}
+		// Start at the seek window containing the range start; seek offsets
+		// stay aligned to FT as the playlist server expects.
+		if skip := in.Window.From.Sub(ftDate) / (fixedSeek * time.Second); skip > 0 {
+			seek = util.FormatTimestamp(ftDate.Add(skip * fixedSeek * time.Second))
+		}
+		if !in.Window.Until.IsZero() && in.Window.Until.Before(endDate) {
+			endDate = in.Window.Until
+		}
+	}
 
 	for {
 		seekDate, err := util.ParseTimestamp(seek)
@@ -102,7 +159,11 @@ func (p *PlaylistBuilder) BuildSegmentURLs(ctx context.Context, in SegmentInput)
 		if chunkStatus < 200 || chunkStatus >= 300 {
 			return nil, fmt.Errorf("chunklist request failed: %d", chunkStatus)
 		}
-		links = append(links, allDataLines(chunkText)...)
+		for _, seg := range parseChunklist(chunkText, seekDate) {
+			if in.Window.IsZero() || seg.overlaps(in.Window) {
+				links = append(links, seg)
+			}
+		}
 		next, err := util.StepTimestamp(seek, fixedSeek)
 		if err != nil {
 			return nil, err
@@ -121,6 +182,42 @@ func firstDataLine(m3u8 string) (string, error) {
 	return lines[0], nil
 }
 
+// parseChunklist returns the media segments of a chunklist whose first
+// segment starts at start unless the playlist states its own date-time.
+func parseChunklist(m3u8 string, start time.Time) []Segment {
+	out := make([]Segment, 0, 64)
+	cursor := start
+	var dur time.Duration
+	var stamp time.Time
+	for _, line := range strings.Split(m3u8, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			v := strings.TrimPrefix(line, "#EXTINF:")
+			if i := strings.IndexByte(v, ','); i >= 0 {
+				v = v[:i]
+			}
+			if sec, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				dur = time.Duration(sec * float64(time.Second))
+			}
+		case strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
+			if t, err := time.Parse(time.RFC3339Nano, strings.TrimPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:")); err == nil {
+				stamp = t
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			if !stamp.IsZero() {
+				cursor = stamp
+			}
+			out = append(out, Segment{URL: line, Start: cursor, Duration: dur})
+			cursor = cursor.Add(dur)
+			dur, stamp = 0, time.Time{}
+		}
+	}
+	return out
+}
+
 func allDataLines(m3u8 string) []string {
 	out := make([]string, 0, strings.Count(m3u8, "\n")+1)
 	start := 0
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
+
+	"rajidou/internal/util"
 )
 
 func TestFirstDataLineNoData(t *testing.T) {
@@ -100,3 +103,73 @@ func TestBuildSegmentURLsInvalidTO(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func TestParseChunklistTiming(t *testing.T) {
+	start := time.Date(2026, 2, 19, 0, 0, 0, 0, util.Tokyo)
+	segs := parseChunklist("#EXTM3U\n#EXTINF:5.5,\na.aac\n#EXTINF:5,\nb.aac\n#EXT-X-PROGRAM-DATE-TIME:2026-02-19T00:01:00+09:00\n#EXTINF:5,\nc.aac\n", start)
+	if len(segs) != 3 {
+		t.Fatalf("want 3 segments, got %d", len(segs))
+	}
+	if !segs[1].Start.Equal(start.Add(5500*time.Millisecond)) || segs[1].Duration != 5*time.Second {
+		t.Fatalf("unexpected second segment: %+v", segs[1])
+	}
+	if want := time.Date(2026, 2, 19, 0, 1, 0, 0, time.FixedZone("JST", 9*3600)); !segs[2].Start.Equal(want) {
+		t.Fatalf("program date-time not honored: %s", segs[2].Start)
+	}
+}
+
+func TestParseChunklistUTCDateTimeFallsInProgramWindow(t *testing.T) {
+	ft, _ := util.ParseTimestamp("20260219000000")
+	to, _ := util.ParseTimestamp("20260219000100")
+	segs := parseChunklist("#EXTM3U\n#EXT-X-PROGRAM-DATE-TIME:2026-02-18T15:00:10Z\n#EXTINF:5,\na.aac\n", ft)
+	if len(segs) != 1 || !(TimeRange{From: ft, Until: to}).Contains(segs[0].Start) {
+		t.Fatalf("segment outside the program window: %+v", segs)
+	}
+}
+
+func TestBuildSegmentsWindowRequestsOnlyCoveringSeeks(t *testing.T) {
+	var seeks []string
+	net, closeFn := newMockNetClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/station/stream/pc_html5/AAA.xml":
+			_, _ = fmt.Fprint(w, `<root><playlist_create_url>https://radiko.jp/tf/playlist.m3u8</playlist_create_url></root>`)
+		case "/tf/playlist.m3u8":
+			seek := r.URL.Query().Get("seek")
+			seeks = append(seeks, seek)
+			_, _ = fmt.Fprintf(w, "#EXTM3U\nhttps://radiko.jp/chunk.m3u8?seek=%s\n", seek)
+		case "/chunk.m3u8":
+			base := r.URL.Query().Get("seek")[10:12]
+			_, _ = fmt.Fprint(w, "#EXTM3U\n")
+			for i := 0; i < 5; i++ {
+				_, _ = fmt.Fprintf(w, "#EXTINF:60,\nhttps://radiko.jp/%s-%d.aac\n", base, i)
+			}
+		default:
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+	})
+	defer closeFn()
+
+	ft := time.Date(2026, 2, 19, 0, 0, 0, 0, util.Tokyo)
+	segs, err := NewPlaylistBuilder(net).BuildSegments(context.Background(), SegmentInput{
+		StationID: "AAA",
+		FT:        "20260219000000",
+		TO:        "20260219003000",
+		Window:    TimeRange{From: ft.Add(12 * time.Minute), Until: ft.Add(17 * time.Minute)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(seeks) != 2 || seeks[0] != "20260219001000" || seeks[1] != "20260219001500" {
+		t.Fatalf("unexpected seeks: %v", seeks)
+	}
+	urls := SegmentURLs(segs)
+	want := []string{"10-2", "10-3", "10-4", "15-0", "15-1"}
+	if len(urls) != len(want) {
+		t.Fatalf("want %d segments, got %v", len(want), urls)
+	}
+	for i, w := range want {
+		if urls[i] != "https://radiko.jp/"+w+".aac" {
+			t.Fatalf("segment %d: want %s, got %s", i, w, urls[i])
+		}
+	}
+}
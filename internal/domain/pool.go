@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Source map in this file:
+//   - process-wide fetch pool is CLI-specific; Rajiko downloads one program
+//     at a time.
+//
+// FetchPool bounds segment fetches in flight across every download of the
+// process. Each download takes a lane, and free slots go to waiting lanes in
+// turn, so a long program cannot starve the others. A nil pool never blocks.
+type FetchPool struct {
+	mu   sync.Mutex
+	free int
+	// ring lists lanes with waiters in the order they take turns.
+	ring []*FetchLane
+	next int
+}
+
+// FetchLane is one download's queue in a FetchPool.
+type FetchLane struct {
+	pool    *FetchPool
+	waiters []chan struct{}
+}
+
+// NewFetchPool creates a pool allowing limit fetches at once. A non-positive
+// limit falls back to a practical default.
+func NewFetchPool(limit int) *FetchPool {
+	if limit <= 0 {
+		limit = 8
+	}
+	return &FetchPool{free: limit}
+}
+
+// Lane returns a new lane for one download; a nil pool yields a nil lane.
+func (p *FetchPool) Lane() *FetchLane {
+	if p == nil {
+		return nil
+	}
+	return &FetchLane{pool: p}
+}
+
+// Acquire blocks until the lane is granted a slot or ctx is done. Every
+// successful Acquire must be paired with Release.
+func (l *FetchLane) Acquire(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	p := l.pool
+	p.mu.Lock()
+	// Free slots only exist while nobody waits, so taking one is fair.
+	if p.free > 0 {
+		p.free--
+		p.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	l.waiters = append(l.waiters, ch)
+	if len(l.waiters) == 1 {
+		p.ring = append(p.ring, l)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+	}
+	p.mu.Lock()
+	i := slices.Index(l.waiters, ch)
+	if i < 0 {
+		// The slot was granted while ctx was being cancelled; pass it on.
+		p.mu.Unlock()
+		l.Release()
+		return ctx.Err()
+	}
+	l.waiters = slices.Delete(l.waiters, i, i+1)
+	if len(l.waiters) == 0 {
+		p.dropLocked(l)
+	}
+	p.mu.Unlock()
+	return ctx.Err()
+}
+
+// Release returns a slot, handing it to the next lane in turn that waits.
+func (l *FetchLane) Release() {
+	if l == nil {
+		return
+	}
+	p := l.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.ring) == 0 {
+		p.free++
+		return
+	}
+	if p.next >= len(p.ring) {
+		p.next = 0
+	}
+	lane := p.ring[p.next]
+	close(lane.waiters[0])
+	lane.waiters = lane.waiters[1:]
+	if len(lane.waiters) == 0 {
+		// The following lane moves into this position and goes next.
+		p.ring = slices.Delete(p.ring, p.next, p.next+1)
+		return
+	}
+	p.next++
+}
+
+// dropLocked removes l from the ring, keeping the turn on the lane that
+// would have gone next.
+func (p *FetchPool) dropLocked(l *FetchLane) {
+	i := slices.Index(p.ring, l)
+	if i < 0 {
+		return
+	}
+	p.ring = slices.Delete(p.ring, i, i+1)
+	if i < p.next {
+		p.next--
+	}
+}
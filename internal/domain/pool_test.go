@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFetchPoolGrantsLanesInTurn(t *testing.T) {
+	p := NewFetchPool(1)
+	big, small := p.Lane(), p.Lane()
+	if err := big.Acquire(context.Background()); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	order := make(chan string, 4)
+	wait := func(l *FetchLane, name string) {
+		go func() {
+			if err := l.Acquire(context.Background()); err == nil {
+				order <- name
+			}
+		}()
+		// Let the waiter queue before the next one.
+		time.Sleep(10 * time.Millisecond)
+	}
+	wait(big, "big1")
+	wait(big, "big2")
+	wait(small, "small")
+	for _, want := range []string{"big1", "small", "big2"} {
+		big.Release()
+		if got := <-order; got != want {
+			t.Fatalf("want %s next, got %s", want, got)
+		}
+	}
+}
+
+func TestFetchPoolAcquireHonoursContext(t *testing.T) {
+	p := NewFetchPool(1)
+	l := p.Lane()
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Acquire(ctx); err == nil {
+		t.Fatal("acquire must fail once ctx is done")
+	}
+	l.Release()
+	// The cancelled waiter must not have kept the released slot.
+	if err := p.Lane().Acquire(context.Background()); err != nil {
+		t.Fatalf("slot was lost: %v", err)
+	}
+	var nilPool *FetchPool
+	if err := nilPool.Lane().Acquire(context.Background()); err != nil {
+		t.Fatalf("nil pool must not block: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	"rajidou/internal/netx"
@@ -19,11 +20,16 @@ type ProgramResolver struct {
 }
 
 // ProgramMeta describes the time window and title required for download naming
-// and playlist range requests.
+// and playlist range requests, plus descriptive fields used for sidecar files.
 type ProgramMeta struct {
-	FT    string
-	TO    string
-	Title string
+	FT          string
+	TO          string
+	Title       string
+	Performer   string
+	Description string
+	Info        string
+	Image       string
+	URL         string
 }
 
 // NewProgramResolver creates a ProgramResolver backed by the shared HTTP client.
@@ -34,14 +40,10 @@ func NewProgramResolver(net *netx.Client) *ProgramResolver {
 // ResolveProgramMeta fetches weekly XML and extracts TO/title for the exact FT
 // program block identified by station and start timestamp.
 func (r *ProgramResolver) ResolveProgramMeta(ctx context.Context, stationID, ft string) (ProgramMeta, error) {
-	url := fmt.Sprintf("https://api.radiko.jp/program/v3/weekly/%s.xml", stationID)
-	status, xml, err := r.net.GetText(ctx, url, nil)
+	xml, err := r.weeklyXML(ctx, stationID)
 	if err != nil {
 		return ProgramMeta{}, err
 	}
-	if status < 200 || status >= 300 {
-		return ProgramMeta{}, fmt.Errorf("weekly program xml failed: %d", status)
-	}
 
 	esc := regexp.QuoteMeta(ft)
 	re := regexp.MustCompile(`<prog\s+[^>]*ft="` + esc + `"\s+to="(\d{14})"[^>]*>([\s\S]*?)</prog>`)
@@ -49,13 +51,72 @@ func (r *ProgramResolver) ResolveProgramMeta(ctx context.Context, stationID, ft
 	if len(m) < 3 {
 		return ProgramMeta{}, fmt.Errorf("cannot find program range for station=%s ft=%s", stationID, ft)
 	}
-	block := m[2]
-	title := ""
-	tm := regexp.MustCompile(`<title>([\s\S]*?)</title>`).FindStringSubmatch(block)
-	if len(tm) >= 2 {
-		title = decodeXML(strings.TrimSpace(tm[1]))
+	return progMeta(ft, m[1], m[2]), nil
+}
+
+// ListPrograms returns every program in the station's weekly XML in
+// broadcast order.
+func (r *ProgramResolver) ListPrograms(ctx context.Context, stationID string) ([]ProgramMeta, error) {
+	xml, err := r.weeklyXML(ctx, stationID)
+	if err != nil {
+		return nil, err
+	}
+	matches := progPattern.FindAllStringSubmatch(xml, -1)
+	out := make([]ProgramMeta, 0, len(matches))
+	for _, m := range matches {
+		out = append(out, progMeta(m[1], m[2], m[3]))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].FT < out[j].FT })
+	return out, nil
+}
+
+func (r *ProgramResolver) weeklyXML(ctx context.Context, stationID string) (string, error) {
+	url := fmt.Sprintf("https://api.radiko.jp/program/v3/weekly/%s.xml", stationID)
+	status, xml, err := r.net.GetText(netx.WithCache(ctx), url, nil)
+	if err != nil {
+		return "", err
+	}
+	if status < 200 || status >= 300 {
+		return "", fmt.Errorf("weekly program xml failed: %d", status)
+	}
+	return xml, nil
+}
+
+// progPattern matches one <prog> element with its ft, to and body.
+var progPattern = regexp.MustCompile(`<prog\s+[^>]*ft="(\d{14})"\s+to="(\d{14})"[^>]*>([\s\S]*?)</prog>`)
+
+// progFieldPatterns match the <prog> child elements read by progField.
+var progFieldPatterns = map[string]*regexp.Regexp{
+	"title": regexp.MustCompile(`<title>([\s\S]*?)</title>`),
+	"pfm":   regexp.MustCompile(`<pfm>([\s\S]*?)</pfm>`),
+	"desc":  regexp.MustCompile(`<desc>([\s\S]*?)</desc>`),
+	"info":  regexp.MustCompile(`<info>([\s\S]*?)</info>`),
+	"img":   regexp.MustCompile(`<img>([\s\S]*?)</img>`),
+	"url":   regexp.MustCompile(`<url>([\s\S]*?)</url>`),
+}
+
+// progMeta builds program metadata from one <prog> element.
+func progMeta(ft, to, block string) ProgramMeta {
+	return ProgramMeta{
+		FT:          ft,
+		TO:          to,
+		Title:       progField(block, "title"),
+		Performer:   progField(block, "pfm"),
+		Description: progField(block, "desc"),
+		Info:        progField(block, "info"),
+		Image:       progField(block, "img"),
+		URL:         progField(block, "url"),
+	}
+}
+
+// progField returns the decoded text of the first <tag>...</tag> element in a
+// program block, or an empty string when the element is absent or self-closed.
+func progField(block, tag string) string {
+	m := progFieldPatterns[tag].FindStringSubmatch(block)
+	if len(m) < 2 {
+		return ""
 	}
-	return ProgramMeta{FT: ft, TO: m[1], Title: title}, nil
+	return decodeXML(strings.TrimSpace(m[1]))
 }
 
 func decodeXML(s string) string {
@@ -20,7 +20,7 @@ func TestResolveProgramMetaSuccess(t *testing.T) {
 		if r.URL.Path != "/program/v3/weekly/AAA.xml" {
 			t.Fatalf("unexpected path: %s", r.URL.Path)
 		}
-		_, _ = fmt.Fprint(w, `<radiko><prog ft="20260219000000" to="20260219003000"><title>A&amp;B</title></prog></radiko>`)
+		_, _ = fmt.Fprint(w, `<radiko><prog ft="20260219000000" to="20260219003000"><title>A&amp;B</title><pfm>P</pfm><desc/><img>https://img/x.png</img></prog></radiko>`)
 	})
 	defer closeFn()
 
@@ -29,7 +29,7 @@ func TestResolveProgramMetaSuccess(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if meta.TO != "20260219003000" || meta.Title != "A&B" {
+	if meta.TO != "20260219003000" || meta.Title != "A&B" || meta.Performer != "P" || meta.Image != "https://img/x.png" || meta.Description != "" {
 		t.Fatalf("unexpected meta: %+v", meta)
 	}
 }
@@ -57,3 +57,18 @@ func TestResolveProgramMetaMissingProgram(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func TestListProgramsSortsByStart(t *testing.T) {
+	net, closeFn := newMockNetClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `<radiko><prog ft="20260219010000" to="20260219020000"><title>B</title></prog><prog ft="20260219000000" to="20260219010000"><title>A</title></prog></radiko>`)
+	})
+	defer closeFn()
+
+	progs, err := NewProgramResolver(net).ListPrograms(context.Background(), "AAA")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(progs) != 2 || progs[0].Title != "A" || progs[1].TO != "20260219020000" {
+		t.Fatalf("unexpected programs: %+v", progs)
+	}
+}
@@ -153,7 +153,7 @@ func ResolveStationAreaID(ctx context.Context, net *netx.Client, stationID strin
 // whether a second cache lookup is meaningful.
 func warmAreaStations(ctx context.Context, net *netx.Client, areaID string) bool {
 	url := fmt.Sprintf("https://radiko.jp/v3/station/list/%s.xml", areaID)
-	status, xml, err := net.GetText(ctx, url, nil)
+	status, xml, err := net.GetText(netx.WithCache(ctx), url, nil)
 	if err != nil || status < 200 || status >= 300 {
 		return false
 	}
@@ -0,0 +1,194 @@
+package domain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"rajidou/internal/util"
+)
+
+// Source map in this file:
+//   - resume journal is CLI-specific; it persists ordered-merge progress so an
+//     interrupted download can continue from its part file.
+//
+// JournalSuffix marks the resume journal stored next to a part file.
+const JournalSuffix = ".resume.json"
+
+// journalInterval is how many written segments may accumulate before the
+// journal is persisted again. Each save rewrites the whole journal, so saving
+// per segment would make long programs quadratic in I/O.
+const journalInterval = 32
+
+// JournalPath returns the resume journal path for outPath.
+func JournalPath(outPath string) string {
+	return PartPath(outPath) + JournalSuffix
+}
+
+// resumeJournal records which segments of an expanded playlist are already
+// durable in the part file and where each one starts. Header is the tag
+// written before the first segment; the trim window and BestEffort are the
+// merge settings the written segments were trimmed and gap-filled under.
+type resumeJournal struct {
+	Version    int             `json:"version"`
+	URLs       []string        `json:"urls"`
+	Header     []byte          `json:"header,omitempty"`
+	TrimFrom   time.Time       `json:"trimFrom"`
+	TrimUntil  time.Time       `json:"trimUntil"`
+	BestEffort bool            `json:"bestEffort,omitempty"`
+	Segments   []resumeSegment `json:"segments"`
+	// Gaps lists segments written as silence in best-effort mode.
+	Gaps []Gap `json:"gaps,omitempty"`
+}
+
+type resumeSegment struct {
+	Index  int   `json:"index"`
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+}
+
+// newResumeJournal returns an empty journal for merging urls with opt.
+func newResumeJournal(urls []string, opt MergeOptions) *resumeJournal {
+	return &resumeJournal{Version: 1, URLs: urls, Header: opt.Header, TrimFrom: opt.Window.From, TrimUntil: opt.Window.Until, BestEffort: opt.BestEffort}
+}
+
+// loadResumeJournal reads the journal at path and returns it only when it was
+// written for exactly the same segment URL list, header, trim window and
+// best-effort mode as fresh and describes a contiguous prefix. Chapter frames
+// of the header are not compared; a resumed part keeps the journaled header
+// already on disk. Any other journal is stale and fresh is returned instead.
+func loadResumeJournal(path string, fresh *resumeJournal) (*resumeJournal, bool) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fresh, false
+	}
+	var j resumeJournal
+	if err := json.Unmarshal(raw, &j); err != nil {
+		return fresh, false
+	}
+	if j.Version != 1 || !slices.Equal(j.URLs, fresh.URLs) || !bytes.Equal(id3StableFrames(j.Header), id3StableFrames(fresh.Header)) {
+		// The playlist expansion or header changed; byte offsets no longer line up.
+		return fresh, false
+	}
+	if !j.TrimFrom.Equal(fresh.TrimFrom) || !j.TrimUntil.Equal(fresh.TrimUntil) || j.BestEffort != fresh.BestEffort {
+		// The prefix was trimmed or gap-filled under other settings.
+		return fresh, false
+	}
+	offset := int64(len(j.Header))
+	for i, seg := range j.Segments {
+		if seg.Index != i || seg.Offset != offset {
+			return fresh, false
+		}
+		offset += seg.Size
+	}
+	// Gaps past the journaled prefix are fetched again.
+	kept := j.Gaps[:0]
+	for _, g := range j.Gaps {
+		if g.Index < len(j.Segments) {
+			kept = append(kept, g)
+		}
+	}
+	j.Gaps = kept
+	return &j, true
+}
+
+// resumePoint returns the next segment index to fetch and the part file size
+// covered by the journal.
+func (j *resumeJournal) resumePoint() (int, int64) {
+	if len(j.Segments) == 0 {
+		return 0, int64(len(j.Header))
+	}
+	last := j.Segments[len(j.Segments)-1]
+	return len(j.Segments), last.Offset + last.Size
+}
+
+func (j *resumeJournal) add(idx int, offset int64, size int) {
+	j.Segments = append(j.Segments, resumeSegment{Index: idx, Offset: offset, Size: int64(size)})
+}
+
+func (j *resumeJournal) save(path string) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, b, 0o644)
+}
+
+// resumablePart is an open part file positioned at the end of its journaled
+// prefix, with hash and stream summary already covering that prefix.
+type resumablePart struct {
+	f           *os.File
+	journal     *resumeJournal
+	journalPath string
+	hash        hash.Hash
+	stream      ADTSInfo
+	next        int
+	offset      int64
+}
+
+// openResumablePart opens the part file for outPath and continues from its
+// journal when the journal matches urls and opt and the part file holds at
+// least the journaled bytes. Otherwise the part file is restarted with
+// opt.Header and a fresh journal.
+func openResumablePart(outPath string, urls []string, opt MergeOptions) (*resumablePart, error) {
+	jp := JournalPath(outPath)
+	header := opt.Header
+	j, ok := loadResumeJournal(jp, newResumeJournal(urls, opt))
+	f, err := os.OpenFile(PartPath(outPath), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	p := &resumablePart{f: f, journal: j, journalPath: jp, hash: sha256.New()}
+	if ok {
+		p.next, p.offset = j.resumePoint()
+		if fi, err := f.Stat(); err != nil || fi.Size() < p.offset {
+			// The part file lost data the journal claims; start over.
+			p.journal = newResumeJournal(urls, opt)
+			p.next, p.offset = 0, 0
+		}
+	}
+	if p.offset == 0 && len(header) > 0 {
+		if _, err := f.WriteAt(header, 0); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		p.offset = int64(len(header))
+	}
+	// Bytes past the journaled prefix were never confirmed durable; drop them.
+	if err := f.Truncate(p.offset); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	// One pass over the kept prefix primes the hash and recovers its stream
+	// summary; the tee is drained afterwards in case analysis stopped early.
+	prefix := io.TeeReader(io.NewSectionReader(f, 0, p.offset), p.hash)
+	p.stream, _ = AnalyzeADTS(prefix)
+	if _, err := io.Copy(io.Discard, prefix); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(p.offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// checkpoint makes written bytes durable before the journal claims them.
+func (p *resumablePart) checkpoint() error {
+	if err := p.f.Sync(); err != nil {
+		return err
+	}
+	return p.journal.save(p.journalPath)
+}
+
+// suspend checkpoints and closes the part file so a later run can resume it.
+func (p *resumablePart) suspend() {
+	_ = p.checkpoint()
+	_ = p.f.Close()
+}
@@ -0,0 +1,198 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rajidou/internal/netx"
+	"rajidou/internal/util"
+)
+
+func TestDownloadAndMergeAacSegmentsResumesFromJournal(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[int]int{}
+	failAt := 5
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		mu.Lock()
+		hits[n]++
+		fail := n == failAt
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(testADTSFrameFill(1, byte(n)))
+	}))
+	defer s.Close()
+
+	urls := make([]string, 10)
+	want := make([]byte, 0, len(urls)*8)
+	for i := range urls {
+		urls[i] = s.URL + "/" + strconv.Itoa(i)
+		want = append(want, testADTSFrameFill(1, byte(i))...)
+	}
+	tmp := t.TempDir()
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	d := NewAudioDownloader(net, 1)
+	if _, err := d.DownloadAndMergeAacSegments(context.Background(), testSegments(urls...), tmp, "x.aac", MergeOptions{}); err == nil {
+		t.Fatal("expected first run to fail")
+	}
+	outPath := filepath.Join(tmp, "x.aac")
+	if _, err := os.Stat(JournalPath(outPath)); err != nil {
+		t.Fatalf("journal should be kept after failure: %v", err)
+	}
+	if removed, _ := RemoveStalePartFiles(tmp); len(removed) != 0 {
+		t.Fatalf("resumable part must not be removed: %v", removed)
+	}
+
+	mu.Lock()
+	failAt = -1
+	hits = map[int]int{}
+	mu.Unlock()
+	out, err := d.DownloadAndMergeAacSegments(context.Background(), testSegments(urls...), tmp, "x.aac", MergeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := os.ReadFile(out.Path)
+	if !bytes.Equal(b, want) {
+		t.Fatalf("unexpected output: %v", b)
+	}
+	if out.Size != int64(len(want)) || out.Stream.Frames != len(urls) {
+		t.Fatalf("want size %d and %d frames, got %d and %d", len(want), len(urls), out.Size, out.Stream.Frames)
+	}
+	for i := 0; i < 5; i++ {
+		if hits[i] != 0 {
+			t.Fatalf("segment %d should not be refetched", i)
+		}
+	}
+	if _, err := os.Stat(JournalPath(outPath)); !os.IsNotExist(err) {
+		t.Fatalf("journal should be removed after success: %v", err)
+	}
+}
+
+func TestLoadResumeJournalInvalidatedByPlaylistChange(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "x.aac.part.resume.json")
+	j := &resumeJournal{Version: 1, URLs: []string{"a", "b"}}
+	j.add(0, 0, 3)
+	if err := j.save(p); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if got, ok := loadResumeJournal(p, newResumeJournal([]string{"a", "b"}, MergeOptions{})); !ok || len(got.Segments) != 1 {
+		t.Fatalf("matching journal should load: %+v %v", got, ok)
+	}
+	if got, ok := loadResumeJournal(p, newResumeJournal([]string{"a", "c"}, MergeOptions{})); ok || len(got.Segments) != 0 {
+		t.Fatalf("changed playlist must invalidate journal: %+v %v", got, ok)
+	}
+	if got, ok := loadResumeJournal(p, newResumeJournal([]string{"a", "b"}, MergeOptions{Header: []byte("ID3")})); ok || len(got.Segments) != 0 {
+		t.Fatalf("changed header must invalidate journal: %+v %v", got, ok)
+	}
+}
+
+func TestLoadResumeJournalInvalidatedByMergeSettings(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "x.aac.part.resume.json")
+	ft := time.Date(2026, 1, 1, 0, 0, 0, 0, util.Tokyo)
+	opt := MergeOptions{Window: TimeRange{From: ft, Until: ft.Add(time.Hour)}, BestEffort: true}
+	j := newResumeJournal([]string{"a"}, opt)
+	j.add(0, 0, 3)
+	if err := j.save(p); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if _, ok := loadResumeJournal(p, newResumeJournal([]string{"a"}, opt)); !ok {
+		t.Fatal("matching settings should load the journal")
+	}
+	padded := opt
+	padded.Window = opt.Window.Pad(5 * time.Second)
+	if _, ok := loadResumeJournal(p, newResumeJournal([]string{"a"}, padded)); ok {
+		t.Fatal("changed trim padding must invalidate journal")
+	}
+	strict := opt
+	strict.BestEffort = false
+	if _, ok := loadResumeJournal(p, newResumeJournal([]string{"a"}, strict)); ok {
+		t.Fatal("changed best-effort mode must invalidate journal")
+	}
+}
+
+func TestLoadResumeJournalIgnoresChapterChanges(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "x.aac.part.resume.json")
+	tag := func(title string, songs ...string) []byte {
+		var chapters []id3Chapter
+		for i, s := range songs {
+			chapters = append(chapters, id3Chapter{title: s, start: time.Duration(i) * time.Minute, end: time.Duration(i+1) * time.Minute})
+		}
+		return buildID3Tag(append([]id3Frame{id3Text("TIT2", title)}, id3Chapters(chapters)...)...)
+	}
+	old := tag("T", "a", "b")
+	j := &resumeJournal{Version: 1, URLs: []string{"a"}, Header: old}
+	j.add(0, int64(len(old)), 3)
+	if err := j.save(p); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	got, ok := loadResumeJournal(p, newResumeJournal([]string{"a"}, MergeOptions{Header: tag("T", "a", "b", "c")}))
+	if !ok || !bytes.Equal(got.Header, old) {
+		t.Fatalf("changed song chapters should keep the journal and its header: %+v %v", got, ok)
+	}
+	if next, offset := got.resumePoint(); next != 1 || offset != int64(len(old))+3 {
+		t.Fatalf("unexpected resume point %d/%d", next, offset)
+	}
+	if _, ok := loadResumeJournal(p, newResumeJournal([]string{"a"}, MergeOptions{Header: tag("U", "a", "b")})); ok {
+		t.Fatal("changed title must invalidate journal")
+	}
+}
+
+func TestDownloadAndMergeAacSegmentsResumesAfterHeader(t *testing.T) {
+	failAt := 3
+	var mu sync.Mutex
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		mu.Lock()
+		fail := n == failAt
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(testADTSFrameFill(1, byte(n)))
+	}))
+	defer s.Close()
+
+	header := buildID3Tag(id3Text("TIT2", "joined"))
+	urls := make([]string, 6)
+	want := append([]byte{}, header...)
+	for i := range urls {
+		urls[i] = s.URL + "/" + strconv.Itoa(i)
+		want = append(want, testADTSFrameFill(1, byte(i))...)
+	}
+	tmp := t.TempDir()
+	net := netx.NewClient(2*time.Second, netx.RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	d := NewAudioDownloader(net, 1)
+	opt := MergeOptions{Header: header}
+	if _, err := d.DownloadAndMergeAacSegments(context.Background(), testSegments(urls...), tmp, "x.aac", opt); err == nil {
+		t.Fatal("expected first run to fail")
+	}
+	mu.Lock()
+	failAt = -1
+	mu.Unlock()
+	out, err := d.DownloadAndMergeAacSegments(context.Background(), testSegments(urls...), tmp, "x.aac", opt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := os.ReadFile(out.Path)
+	if !bytes.Equal(b, want) || out.Size != int64(len(want)) || out.Stream.Frames != len(urls) {
+		t.Fatalf("unexpected output: %+v %v", out, b)
+	}
+	if sum := sha256.Sum256(want); out.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("hash must cover the header")
+	}
+}
@@ -0,0 +1,173 @@
+package domain
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"rajidou/internal/util"
+)
+
+// Source map in this file:
+//   - sidecar metadata output is CLI-specific; NFO layout follows the
+//     Kodi/Jellyfin episodedetails schema.
+//
+// ProgramRecord is the per-episode metadata written next to an audio output.
+type ProgramRecord struct {
+	StationID   string `json:"station"`
+	FT          string `json:"ft"`
+	TO          string `json:"to"`
+	Title       string `json:"title"`
+	Performer   string `json:"performer,omitempty"`
+	Description string `json:"description,omitempty"`
+	Info        string `json:"info,omitempty"`
+	Image       string `json:"image,omitempty"`
+	ProgramURL  string `json:"programUrl,omitempty"`
+	DetailURL   string `json:"detailUrl"`
+	AreaID      string `json:"area"`
+	Segments    int    `json:"segments"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	File        string `json:"file"`
+	// Duration is the decoded audio length in seconds.
+	Duration float64  `json:"durationSeconds"`
+	Audio    ADTSInfo `json:"audio"`
+	// ClipFrom and ClipTo bound the downloaded part of a partial download.
+	ClipFrom string `json:"clipFrom,omitempty"`
+	ClipTo   string `json:"clipTo,omitempty"`
+	// Part and Parts number a split download's files from 1.
+	Part  int `json:"part,omitempty"`
+	Parts int `json:"parts,omitempty"`
+	// Chapters lists the programs of a joined download in order.
+	Chapters []ProgramChapter `json:"chapters,omitempty"`
+	// Gaps lists segments of the download that were filled with silence.
+	Gaps []Gap `json:"gaps,omitempty"`
+	// Songs lists the on-air songs that start inside this file.
+	Songs []Song `json:"songs,omitempty"`
+}
+
+// ProgramChapter is one program inside a joined download.
+type ProgramChapter struct {
+	Title string `json:"title"`
+	FT    string `json:"ft"`
+	TO    string `json:"to"`
+}
+
+// NewProgramRecord combines resolved program metadata and the merged audio
+// result into a sidecar record.
+func NewProgramRecord(detail DetailRef, detailURL, areaID string, meta ProgramMeta, audio AudioResult) ProgramRecord {
+	return ProgramRecord{
+		StationID:   detail.StationID,
+		FT:          meta.FT,
+		TO:          meta.TO,
+		Title:       meta.Title,
+		Performer:   meta.Performer,
+		Description: meta.Description,
+		Info:        meta.Info,
+		Image:       meta.Image,
+		ProgramURL:  meta.URL,
+		DetailURL:   detailURL,
+		AreaID:      areaID,
+		Segments:    audio.Segments,
+		Size:        audio.Size,
+		SHA256:      audio.SHA256,
+		File:        filepath.Base(audio.Path),
+		Duration:    audio.Stream.Duration.Seconds(),
+		Audio:       audio.Stream,
+	}
+}
+
+// SidecarPath returns audioPath with its extension replaced by ext.
+func SidecarPath(audioPath, ext string) string {
+	return strings.TrimSuffix(audioPath, filepath.Ext(audioPath)) + ext
+}
+
+// WriteSidecarJSON atomically writes rec as indented JSON and returns the path.
+func WriteSidecarJSON(audioPath string, rec ProgramRecord) (string, error) {
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := SidecarPath(audioPath, ".json")
+	return path, util.WriteFileAtomic(path, append(b, '\n'), 0o644)
+}
+
+type nfoUniqueID struct {
+	Type    string `xml:"type,attr"`
+	Default bool   `xml:"default,attr"`
+	Value   string `xml:",chardata"`
+}
+
+type nfoActor struct {
+	Name string `xml:"name"`
+}
+
+type nfoEpisode struct {
+	XMLName   xml.Name    `xml:"episodedetails"`
+	Title     string      `xml:"title"`
+	ShowTitle string      `xml:"showtitle"`
+	Plot      string      `xml:"plot,omitempty"`
+	Aired     string      `xml:"aired"`
+	Studio    string      `xml:"studio"`
+	Runtime   int         `xml:"runtime,omitempty"`
+	Thumb     string      `xml:"thumb,omitempty"`
+	UniqueID  nfoUniqueID `xml:"uniqueid"`
+	Actors    []nfoActor  `xml:"actor"`
+}
+
+// WriteSidecarNFO atomically writes rec as a Kodi/Jellyfin episode NFO file
+// and returns the path.
+func WriteSidecarNFO(audioPath string, rec ProgramRecord) (string, error) {
+	title := rec.Title
+	if rec.Parts > 0 {
+		title = fmt.Sprintf("%s (%d/%d)", rec.Title, rec.Part, rec.Parts)
+	}
+	ep := nfoEpisode{
+		Title:     title,
+		ShowTitle: rec.Title,
+		Plot:      firstNonEmpty(rec.Description, rec.Info),
+		Studio:    rec.StationID,
+		Thumb:     rec.Image,
+		UniqueID:  nfoUniqueID{Type: "radiko", Default: true, Value: rec.StationID + "_" + rec.FT},
+	}
+	if ft, err := util.ParseTimestamp(rec.FT); err == nil {
+		ep.Aired = ft.Format("2006-01-02")
+		if to, err := util.ParseTimestamp(rec.TO); err == nil && to.After(ft) {
+			ep.Runtime = int(to.Sub(ft).Minutes())
+		}
+	}
+	for _, name := range splitPerformers(rec.Performer) {
+		ep.Actors = append(ep.Actors, nfoActor{Name: name})
+	}
+	b, err := xml.MarshalIndent(ep, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	data := append([]byte(xml.Header), b...)
+	path := SidecarPath(audioPath, ".nfo")
+	return path, util.WriteFileAtomic(path, append(data, '\n'), 0o644)
+}
+
+// splitPerformers splits Radiko's performer field, which lists names separated
+// by commas or ideographic commas.
+func splitPerformers(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '、' || r == '，' })
+	out := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,198 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"rajidou/internal/netx"
+	"rajidou/internal/util"
+)
+
+// Source map in this file:
+//   - on-air song list request follows the Radiko web player's NOA music API;
+//     CUE sheet and tracklist output is CLI-specific.
+//
+// Song is one on-air music entry of a station.
+type Song struct {
+	Title  string    `json:"title"`
+	Artist string    `json:"artist,omitempty"`
+	Start  time.Time `json:"start"`
+}
+
+// SongListResolver fetches on-air song lists from Radiko.
+type SongListResolver struct {
+	net *netx.Client
+}
+
+// NewSongListResolver creates a SongListResolver backed by the shared HTTP client.
+func NewSongListResolver(net *netx.Client) *SongListResolver {
+	return &SongListResolver{net: net}
+}
+
+// noaTimeLayout is the Tokyo-time layout of the NOA API query parameters.
+const noaTimeLayout = "2006-01-02T15:04:05"
+
+// FetchSongs returns the songs played on stationID that started inside
+// window, in order. Stations and periods without data yield an empty list.
+func (r *SongListResolver) FetchSongs(ctx context.Context, stationID string, window TimeRange) ([]Song, error) {
+	q := url.Values{}
+	q.Set("start_time_gte", window.From.In(util.Tokyo).Format(noaTimeLayout))
+	q.Set("end_time_lt", window.Until.In(util.Tokyo).Format(noaTimeLayout))
+	u := fmt.Sprintf("https://api.radiko.jp/music/api/v1/noas/%s?%s", stationID, q.Encode())
+	status, body, err := r.net.GetBytes(ctx, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status == 404 || status == 204 {
+		return nil, nil
+	}
+	if status < 200 || status >= 300 {
+		return nil, fmt.Errorf("song list request failed: %d", status)
+	}
+	return parseSongList(body, window)
+}
+
+// parseSongList decodes a NOA response and keeps the songs starting in
+// window, sorted by start time without repeats.
+func parseSongList(payload []byte, window TimeRange) ([]Song, error) {
+	var root struct {
+		Data []struct {
+			Title      string `json:"title"`
+			ArtistName string `json:"artist_name"`
+			Start      string `json:"displayed_start_time"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &root); err != nil {
+		return nil, fmt.Errorf("decode song list: %w", err)
+	}
+	out := make([]Song, 0, len(root.Data))
+	for _, item := range root.Data {
+		start, ok := parseNOATime(item.Start)
+		if !ok || strings.TrimSpace(item.Title) == "" || !window.Contains(start) {
+			continue
+		}
+		out = append(out, Song{Title: strings.TrimSpace(item.Title), Artist: strings.TrimSpace(item.ArtistName), Start: start})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	uniq := out[:0]
+	for i, s := range out {
+		// The API can report one airing twice when it is corrected.
+		if i > 0 && s.Start.Equal(out[i-1].Start) && s.Title == out[i-1].Title {
+			continue
+		}
+		uniq = append(uniq, s)
+	}
+	return uniq, nil
+}
+
+func parseNOATime(s string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, util.Tokyo); err == nil {
+		return t, true
+	}
+	if t, err := util.ParseTimestamp(s); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// songTrack is a song positioned in one output file.
+type songTrack struct {
+	Song
+	offset time.Duration
+}
+
+// songTracks positions songs in an output file whose audio starts at start
+// and lasts length. Songs outside the file are dropped.
+func songTracks(songs []Song, start time.Time, length time.Duration) []songTrack {
+	out := make([]songTrack, 0, len(songs))
+	for _, s := range songs {
+		if off := s.Start.Sub(start); off >= 0 && off < length {
+			out = append(out, songTrack{Song: s, offset: off})
+		}
+	}
+	return out
+}
+
+// songChapters returns one chapter per track, each lasting until the next
+// track or the end of the audio.
+func songChapters(tracks []songTrack, length time.Duration) []id3Chapter {
+	out := make([]id3Chapter, len(tracks))
+	for i, t := range tracks {
+		end := length
+		if i+1 < len(tracks) {
+			end = tracks[i+1].offset
+		}
+		out[i] = id3Chapter{title: songLabel(t.Song), start: t.offset, end: end}
+	}
+	return out
+}
+
+func songLabel(s Song) string {
+	if s.Artist == "" {
+		return s.Title
+	}
+	return s.Artist + " - " + s.Title
+}
+
+// WriteSongCue atomically writes a CUE sheet for audioPath with one track per
+// song, preceded by a program track when the first song starts later, and
+// returns the path.
+func WriteSongCue(audioPath string, rec ProgramRecord, tracks []songTrack) (string, error) {
+	var b strings.Builder
+	if rec.Performer != "" {
+		fmt.Fprintf(&b, "PERFORMER %s\n", cueQuote(rec.Performer))
+	}
+	fmt.Fprintf(&b, "TITLE %s\n", cueQuote(rec.Title))
+	// CUE has no AAC file type; players accept WAVE for any decodable audio.
+	fmt.Fprintf(&b, "FILE %s WAVE\n", cueQuote(rec.File))
+	n := 0
+	if len(tracks) == 0 || tracks[0].offset > 0 {
+		n++
+		fmt.Fprintf(&b, "  TRACK %02d AUDIO\n    TITLE %s\n    INDEX 01 00:00:00\n", n, cueQuote(rec.Title))
+	}
+	for _, t := range tracks {
+		n++
+		fmt.Fprintf(&b, "  TRACK %02d AUDIO\n    TITLE %s\n", n, cueQuote(t.Title))
+		if t.Artist != "" {
+			fmt.Fprintf(&b, "    PERFORMER %s\n", cueQuote(t.Artist))
+		}
+		fmt.Fprintf(&b, "    INDEX 01 %s\n", cueTime(t.offset))
+	}
+	path := SidecarPath(audioPath, ".cue")
+	return path, util.WriteFileAtomic(path, []byte(b.String()), 0o644)
+}
+
+// WriteSongTracklist atomically writes a plain-text tracklist with each song's
+// position in the file and its broadcast time, and returns the path.
+func WriteSongTracklist(audioPath string, tracks []songTrack) (string, error) {
+	var b strings.Builder
+	for _, t := range tracks {
+		fmt.Fprintf(&b, "%s [%s] %s\n", clockOffset(t.offset), t.Start.In(util.Tokyo).Format("15:04:05"), songLabel(t.Song))
+	}
+	path := SidecarPath(audioPath, ".tracklist.txt")
+	return path, util.WriteFileAtomic(path, []byte(b.String()), 0o644)
+}
+
+// cueQuote quotes s for a CUE sheet, which has no escape for double quotes.
+func cueQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "'") + `"`
+}
+
+// cueTime formats d as CUE mm:ss:ff with 75 frames per second.
+func cueTime(d time.Duration) string {
+	frames := d * 75 / time.Second
+	return fmt.Sprintf("%02d:%02d:%02d", frames/75/60, frames/75%60, frames%75)
+}
+
+func clockOffset(d time.Duration) string {
+	s := int(d / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"rajidou/internal/util"
+)
+
+func TestParseSongListFiltersSortsAndDedupes(t *testing.T) {
+	ft := time.Date(2026, 1, 1, 20, 0, 0, 0, util.Tokyo)
+	payload := `{"data":[
+		{"title":"Two","artist_name":"B","displayed_start_time":"2026-01-01 20:30:00"},
+		{"title":"One","artist_name":" A ","displayed_start_time":"2026-01-01 20:05:00"},
+		{"title":"Two","artist_name":"B","displayed_start_time":"2026-01-01 20:30:00"},
+		{"title":"Before","displayed_start_time":"2026-01-01 19:55:00"},
+		{"title":"","displayed_start_time":"2026-01-01 20:10:00"}
+	]}`
+	got, err := parseSongList([]byte(payload), TimeRange{From: ft, Until: ft.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].Title != "One" || got[0].Artist != "A" || !got[1].Start.Equal(ft.Add(30*time.Minute)) {
+		t.Fatalf("unexpected songs: %+v", got)
+	}
+}
+
+func TestFetchSongsWithoutDataIsEmpty(t *testing.T) {
+	var query string
+	net, done := newMockNetClient(t, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer done()
+
+	ft := time.Date(2026, 1, 1, 20, 0, 0, 0, util.Tokyo)
+	r := NewSongListResolver(net)
+	got, err := r.FetchSongs(context.Background(), "AAA", TimeRange{From: ft, Until: ft.Add(time.Hour)})
+	if err != nil || len(got) != 0 {
+		t.Fatalf("want empty list, got %+v %v", got, err)
+	}
+	if !strings.Contains(query, "start_time_gte=2026-01-01T20%3A00%3A00") {
+		t.Fatalf("unexpected query: %s", query)
+	}
+}
+
+func TestCueTime(t *testing.T) {
+	if got := cueTime(61*time.Minute + 2*time.Second + 500*time.Millisecond); got != "61:02:37" {
+		t.Fatalf("unexpected cue time: %s", got)
+	}
+}
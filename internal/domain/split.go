@@ -0,0 +1,229 @@
+package domain
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Source map in this file:
+//   - splitting output into parts is CLI-specific with no Rajiko counterpart.
+//
+// SplitOptions selects where a finished download is cut into parts.
+type SplitOptions struct {
+	// Every starts a new part each time this much audio has been written.
+	Every time.Duration
+	// At starts a new part at each of these moments of the program.
+	At []TimePoint
+}
+
+// IsZero reports whether o keeps the download in one file.
+func (o SplitOptions) IsZero() bool {
+	return o.Every <= 0 && len(o.At) == 0
+}
+
+// cutOffsets returns the sorted, distinct offsets from the audio start at
+// which parts after the first begin. ft anchors the TimePoints, start is the
+// broadcast time of the first audio frame, and offsets outside (0, length)
+// are dropped.
+func (o SplitOptions) cutOffsets(ft, start time.Time, length time.Duration) []time.Duration {
+	var out []time.Duration
+	if o.Every > 0 {
+		for d := o.Every; d < length; d += o.Every {
+			out = append(out, d)
+		}
+	}
+	for _, p := range o.At {
+		if d := p.Resolve(ft).Sub(start); d > 0 && d < length {
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	uniq := out[:0]
+	for i, d := range out {
+		if i == 0 || d != out[i-1] {
+			uniq = append(uniq, d)
+		}
+	}
+	return uniq
+}
+
+// partFileName numbers a program file name as part n of total.
+func partFileName(name string, n, total int) string {
+	base := strings.TrimSuffix(name, ".aac")
+	width := len(fmt.Sprint(total))
+	return fmt.Sprintf("%s - part%0*d.aac", base, width, n)
+}
+
+// partTag returns the ID3 tag written at the start of part n of total, with
+// chapters timed from the start of the part.
+func partTag(meta ProgramMeta, n, total int, chapters []id3Chapter) []byte {
+	frames := []id3Frame{
+		id3Text("TIT2", fmt.Sprintf("%s (%d/%d)", meta.Title, n, total)),
+		id3Text("TALB", meta.Title),
+		id3Text("TPE1", meta.Performer),
+		id3Text("TRCK", fmt.Sprintf("%d/%d", n, total)),
+	}
+	if len(chapters) > 0 {
+		frames = append(frames, id3Chapters(chapters)...)
+	}
+	return buildID3Tag(frames...)
+}
+
+// partChapters returns the chapters overlapping [from, until) of the audio,
+// cut to that span and timed from from. Parts start on the first frame at or
+// after their cut, so chapter times may be late by up to one frame.
+func partChapters(chapters []id3Chapter, from, until time.Duration) []id3Chapter {
+	var out []id3Chapter
+	for _, c := range chapters {
+		if c.end <= from || c.start >= until {
+			continue
+		}
+		c.start = max(c.start, from) - from
+		c.end = min(c.end, until) - from
+		out = append(out, c)
+	}
+	return out
+}
+
+// SplitADTSFile cuts the ADTS file at path into len(offsets)+1 parts. Each
+// part after the first starts with the first frame whose start, counted from
+// the beginning of the stream, is at or after its offset, so cuts land on
+// frame boundaries. Offsets must be sorted and shorter than the stream.
+// Each part is named by name, starts with the tag returned by tag, and is
+// written through a part file; path is removed once every part is in place.
+func SplitADTSFile(path string, offsets []time.Duration, name func(n, total int) string, tag func(n, total int) []byte) ([]AudioResult, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	br := bufio.NewReaderSize(src, 64*1024)
+	if head, _ := br.Peek(10); len(head) == 10 {
+		if n := ParseAACPackedHeaderSize(head); n > 0 {
+			if _, err := br.Discard(n); err != nil {
+				return nil, fmt.Errorf("split %s: truncated ID3 tag", path)
+			}
+		}
+	}
+
+	dir := filepath.Dir(path)
+	total := len(offsets) + 1
+	parts := make([]AudioResult, 0, total)
+	var cur *splitPart
+	fail := func(err error) ([]AudioResult, error) {
+		if cur != nil {
+			cur.abort()
+		}
+		for _, p := range parts {
+			_ = os.Remove(p.Path)
+		}
+		return nil, err
+	}
+	frame := make([]byte, 0, 2048)
+	for k := 0; ; k++ {
+		hdr, err := br.Peek(adtsHeaderSize)
+		if len(hdr) == 0 && errors.Is(err, io.EOF) {
+			break
+		}
+		h, ok := parseADTSHeader(hdr)
+		if !ok {
+			return fail(fmt.Errorf("split %s: invalid ADTS frame %d", path, k))
+		}
+		frame = frame[:h.length]
+		if _, err := io.ReadFull(br, frame); err != nil {
+			return fail(fmt.Errorf("split %s: truncated ADTS frame %d", path, k))
+		}
+		at := adtsDuration(k, adtsSampleRates[h.sampleRateIdx])
+		for cur == nil || (len(parts)+1 < total && at >= offsets[len(parts)]) {
+			if cur != nil {
+				res, err := cur.finish()
+				if err != nil {
+					cur = nil
+					return fail(err)
+				}
+				parts = append(parts, res)
+			}
+			n := len(parts) + 1
+			if cur, err = newSplitPart(filepath.Join(dir, name(n, total)), tag(n, total)); err != nil {
+				cur = nil
+				return fail(err)
+			}
+		}
+		if err := cur.write(frame, h); err != nil {
+			return fail(err)
+		}
+	}
+	if cur == nil {
+		return nil, fmt.Errorf("split %s: no ADTS frames", path)
+	}
+	res, err := cur.finish()
+	if err != nil {
+		cur = nil
+		return fail(err)
+	}
+	parts = append(parts, res)
+	if err := os.Remove(path); err != nil {
+		return parts, err
+	}
+	return parts, nil
+}
+
+// splitPart is one part file being written by SplitADTSFile.
+type splitPart struct {
+	f      *os.File
+	w      *bufio.Writer
+	hash   hash.Hash
+	out    string
+	size   int64
+	stream ADTSInfo
+}
+
+func newSplitPart(out string, tag []byte) (*splitPart, error) {
+	f, err := os.OpenFile(PartPath(out), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	p := &splitPart{f: f, hash: sha256.New(), out: out}
+	p.w = bufio.NewWriterSize(io.MultiWriter(f, p.hash), 64*1024)
+	if _, err := p.w.Write(tag); err != nil {
+		p.abort()
+		return nil, err
+	}
+	p.size = int64(len(tag))
+	return p, nil
+}
+
+func (p *splitPart) write(frame []byte, h adtsHeader) error {
+	if _, err := p.w.Write(frame); err != nil {
+		return err
+	}
+	p.size += int64(len(frame))
+	p.stream.add(h)
+	return nil
+}
+
+func (p *splitPart) finish() (AudioResult, error) {
+	if err := p.w.Flush(); err != nil {
+		p.abort()
+		return AudioResult{}, err
+	}
+	if err := finalizePart(p.f, p.out); err != nil {
+		return AudioResult{}, err
+	}
+	return AudioResult{Path: p.out, Size: p.size, SHA256: hex.EncodeToString(p.hash.Sum(nil)), Stream: p.stream}, nil
+}
+
+func (p *splitPart) abort() {
+	_ = p.f.Close()
+	_ = os.Remove(p.f.Name())
+}
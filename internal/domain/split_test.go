@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rajidou/internal/util"
+)
+
+func TestSplitAudioCutsOnFrameBoundaries(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "T - 20260101.aac")
+	if err := os.WriteFile(path, testADTSStream(100), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	info, err := AnalyzeADTS(bytes.NewReader(testADTSStream(100)))
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	ft := time.Date(2026, 1, 1, 0, 0, 0, 0, util.Tokyo)
+	meta := ProgramMeta{FT: "20260101000000", TO: "20260101010000", Title: "T"}
+	audio := AudioResult{Path: path, Segments: 3, Stream: info}
+	parts, err := splitAudio(audio, meta, nil, TimeRange{From: ft}, ft, filepath.Base(path), SplitOptions{Every: time.Second})
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	// A 48kHz frame lasts 21.33ms, so cuts at 1s and 2s land on frames 47 and 94.
+	wantFrames := []int{47, 47, 6}
+	if len(parts) != len(wantFrames) {
+		t.Fatalf("want %d parts, got %d", len(wantFrames), len(parts))
+	}
+	for i, p := range parts {
+		if want := filepath.Join(dir, partFileName(filepath.Base(path), i+1, 3)); p.Path != want {
+			t.Fatalf("part %d: want %s, got %s", i+1, want, p.Path)
+		}
+		raw, err := os.ReadFile(p.Path)
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		got, err := AnalyzeADTS(bytes.NewReader(raw))
+		if err != nil || got.Frames != wantFrames[i] || p.Stream.Frames != wantFrames[i] {
+			t.Fatalf("part %d: want %d frames, got %d/%d (%v)", i+1, wantFrames[i], got.Frames, p.Stream.Frames, err)
+		}
+		if int64(len(raw)) != p.Size || p.Segments != 3 {
+			t.Fatalf("part %d: unexpected result %+v", i+1, p)
+		}
+		if trck := []byte("TRCK"); !bytes.Contains(raw, append(trck, 0, 0, 0, 4, 0, 0, 3, byte('1'+i), '/', '3')) {
+			t.Fatalf("part %d: missing track number tag", i+1)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("merged file should be removed, stat err=%v", err)
+	}
+}
+
+func TestSplitAudioAtTimePoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "T.aac")
+	if err := os.WriteFile(path, testADTSStream(100), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	info, _ := AnalyzeADTS(bytes.NewReader(testADTSStream(100)))
+	at, err := ParseTimePoint("+00:00:01")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	ft := time.Date(2026, 1, 1, 0, 0, 0, 0, util.Tokyo)
+	meta := ProgramMeta{FT: "20260101000000", TO: "20260101010000", Title: "T"}
+	// Audio padded by half a second starts before ft, which shifts the cut.
+	window := TimeRange{From: ft.Add(-500 * time.Millisecond)}
+	parts, err := splitAudio(AudioResult{Path: path, Stream: info}, meta, nil, window, ft, "T.aac", SplitOptions{At: []TimePoint{at}})
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	// 1.5s / 21.33ms = 70.3, so the second part starts at frame 71.
+	if len(parts) != 2 || parts[0].Stream.Frames != 71 || parts[1].Stream.Frames != 29 {
+		t.Fatalf("unexpected parts: %+v", parts)
+	}
+}
+
+func TestSplitAudioSinglePartKeepsFile(t *testing.T) {
+	audio := AudioResult{Path: "unused.aac", Stream: ADTSInfo{Duration: time.Minute}}
+	parts, err := splitAudio(audio, ProgramMeta{}, nil, TimeRange{}, time.Now(), "unused.aac", SplitOptions{Every: time.Hour})
+	if err != nil || len(parts) != 1 || parts[0].Path != "unused.aac" {
+		t.Fatalf("unexpected parts: %+v %v", parts, err)
+	}
+}
+
+func TestSplitAudioAssignsGapsToTheirParts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "T - 20260101.aac")
+	if err := os.WriteFile(path, testADTSStream(100), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	info, err := AnalyzeADTS(bytes.NewReader(testADTSStream(100)))
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	ft := time.Date(2026, 1, 1, 0, 0, 0, 0, util.Tokyo)
+	meta := ProgramMeta{FT: "20260101000000", TO: "20260101010000", Title: "T"}
+	gaps := []Gap{
+		{Index: 1, Start: ft.Add(1200 * time.Millisecond), Seconds: 0.2},
+		{Index: 2, Start: ft.Add(2050 * time.Millisecond), Seconds: 0.05},
+	}
+	audio := AudioResult{Path: path, Segments: 3, Stream: info, Gaps: gaps}
+	parts, err := splitAudio(audio, meta, nil, TimeRange{From: ft}, ft, filepath.Base(path), SplitOptions{Every: time.Second})
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	if len(parts) != 3 || len(parts[0].Gaps) != 0 || len(parts[1].Gaps) != 1 || parts[1].Gaps[0].Index != 1 ||
+		len(parts[2].Gaps) != 1 || parts[2].Gaps[0].Index != 2 {
+		t.Fatalf("gaps not assigned to their parts: %+v", parts)
+	}
+}
+
+func TestSplitAudioCarriesChaptersIntoParts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "T - 20260101.aac")
+	if err := os.WriteFile(path, testADTSStream(100), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	info, err := AnalyzeADTS(bytes.NewReader(testADTSStream(100)))
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	ft := time.Date(2026, 1, 1, 0, 0, 0, 0, util.Tokyo)
+	meta := ProgramMeta{FT: "20260101000000", TO: "20260101010000", Title: "T"}
+	chapters := []id3Chapter{
+		{title: "A", start: 0, end: 1500 * time.Millisecond},
+		{title: "B", start: 1500 * time.Millisecond, end: info.Duration},
+	}
+	audio := AudioResult{Path: path, Segments: 3, Stream: info}
+	parts, err := splitAudio(audio, meta, chapters, TimeRange{From: ft}, ft, filepath.Base(path), SplitOptions{Every: time.Second})
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	// Part 2 holds the end of A and the start of B.
+	for i, want := range []int{1, 2, 1} {
+		raw, err := os.ReadFile(parts[i].Path)
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		tag := raw[:ParseAACPackedHeaderSize(raw)]
+		if !bytes.Contains(tag, []byte("CTOC")) || bytes.Count(tag, []byte("CHAP")) != want {
+			t.Fatalf("part %d: want %d chapters, got tag %q", i+1, want, tag)
+		}
+	}
+	if got := partChapters(chapters, time.Second, 2*time.Second); len(got) != 2 || got[0].end != 500*time.Millisecond || got[1].start != 500*time.Millisecond || got[1].end != time.Second {
+		t.Fatalf("unexpected part chapters: %+v", got)
+	}
+}
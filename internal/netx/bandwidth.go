@@ -0,0 +1,183 @@
+package netx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BandwidthWindow overrides the bandwidth limit during a time of day.
+//
+// From and Until are offsets from local midnight; a window with Until before
+// From wraps past midnight. Limit is in bytes per second, and zero means
+// unlimited.
+type BandwidthWindow struct {
+	From  time.Duration
+	Until time.Duration
+	Limit int64
+}
+
+func (w BandwidthWindow) contains(clock time.Duration) bool {
+	if w.From <= w.Until {
+		return clock >= w.From && clock < w.Until
+	}
+	return clock >= w.From || clock < w.Until
+}
+
+// BandwidthLimiter is a token bucket shared by every response body read
+// through the clients using it. The bucket holds at most one second of
+// traffic, and readers that overdraw it wait until it is refilled. A nil or
+// unlimited limiter never blocks.
+type BandwidthLimiter struct {
+	mu       sync.Mutex
+	limit    int64
+	schedule []BandwidthWindow
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+// NewBandwidthLimiter creates an unlimited limiter; see SetLimit.
+func NewBandwidthLimiter() *BandwidthLimiter {
+	return &BandwidthLimiter{now: time.Now}
+}
+
+// SetLimit sets the default limit in bytes per second (zero is unlimited)
+// and the windows that override it; the first matching window wins.
+func (l *BandwidthLimiter) SetLimit(limit int64, schedule []BandwidthWindow) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.schedule = schedule
+}
+
+// limitAt returns the limit in effect at t.
+func (l *BandwidthLimiter) limitAt(t time.Time) int64 {
+	y, m, d := t.Date()
+	clock := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	for _, w := range l.schedule {
+		if w.contains(clock) {
+			return w.Limit
+		}
+	}
+	return l.limit
+}
+
+// WaitN takes n bytes from the bucket, waiting as long as the bucket is
+// overdrawn or until ctx is done.
+func (l *BandwidthLimiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := l.now()
+	rate := l.limitAt(now)
+	if rate <= 0 {
+		// Start a later limited period from an empty bucket.
+		l.tokens, l.last = 0, now
+		l.mu.Unlock()
+		return nil
+	}
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+	}
+	l.tokens = min(l.tokens, float64(rate))
+	l.last = now
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttleChunk caps each body read so waits stay short and smooth.
+const throttleChunk = 16 * 1024
+
+// throttledBody charges every read of a response body to a limiter.
+type throttledBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *BandwidthLimiter
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := b.limiter.WaitN(b.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// ParseBandwidth parses a rate such as "2MiB/s", "500KB/s" or "1.5M". Units
+// are B, KB, MB, GB (powers of 1000) and KiB, MiB, GiB (powers of 1024); a
+// bare K, M or G is binary. The "/s" suffix is optional. "", "0" and
+// "unlimited" yield zero, meaning no limit.
+func ParseBandwidth(s string) (int64, error) {
+	v := strings.TrimSpace(s)
+	if v == "" || strings.EqualFold(v, "unlimited") {
+		return 0, nil
+	}
+	v = strings.TrimSuffix(v, "/s")
+	i := strings.IndexFunc(v, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	num, unit := v, ""
+	if i >= 0 {
+		num, unit = v[:i], strings.TrimSpace(v[i:])
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q", s)
+	}
+	scale, ok := map[string]float64{
+		"": 1, "B": 1,
+		"KB": 1e3, "MB": 1e6, "GB": 1e9,
+		"K": 1 << 10, "M": 1 << 20, "G": 1 << 30,
+		"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30,
+	}[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid bandwidth unit in %q", s)
+	}
+	return int64(f * scale), nil
+}
+
+// ParseBandwidthWindow parses a schedule entry with "HH:MM" bounds and a
+// ParseBandwidth limit.
+func ParseBandwidthWindow(from, until, limit string) (BandwidthWindow, error) {
+	var w BandwidthWindow
+	var err error
+	if w.From, err = parseClock(from); err != nil {
+		return BandwidthWindow{}, err
+	}
+	if w.Until, err = parseClock(until); err != nil {
+		return BandwidthWindow{}, err
+	}
+	if w.Limit, err = ParseBandwidth(limit); err != nil {
+		return BandwidthWindow{}, err
+	}
+	return w, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
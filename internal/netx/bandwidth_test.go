@@ -0,0 +1,75 @@
+package netx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	for in, want := range map[string]int64{
+		"":          0,
+		"unlimited": 0,
+		"2MiB/s":    2 << 20,
+		"500KB/s":   500_000,
+		"1.5M":      3 << 19,
+		"800":       800,
+	} {
+		got, err := ParseBandwidth(in)
+		if err != nil || got != want {
+			t.Fatalf("%q: want %d, got %d %v", in, want, got, err)
+		}
+	}
+	for _, in := range []string{"fast", "2XB/s", "-1MiB"} {
+		if _, err := ParseBandwidth(in); err == nil {
+			t.Fatalf("%q: want error", in)
+		}
+	}
+}
+
+func TestBandwidthScheduleWrapsPastMidnight(t *testing.T) {
+	night, err := ParseBandwidthWindow("23:00", "06:00", "unlimited")
+	if err != nil {
+		t.Fatalf("parse window: %v", err)
+	}
+	l := NewBandwidthLimiter()
+	l.SetLimit(1000, []BandwidthWindow{night})
+	at := func(h int) time.Time { return time.Date(2026, 1, 1, h, 30, 0, 0, time.Local) }
+	if got := l.limitAt(at(23)); got != 0 {
+		t.Fatalf("23:30 must be unlimited, got %d", got)
+	}
+	if got := l.limitAt(at(5)); got != 0 {
+		t.Fatalf("05:30 must be unlimited, got %d", got)
+	}
+	if got := l.limitAt(at(12)); got != 1000 {
+		t.Fatalf("12:30 must use the default, got %d", got)
+	}
+	if _, err := ParseBandwidthWindow("1am", "06:00", ""); err == nil {
+		t.Fatal("want error for a malformed time")
+	}
+}
+
+func TestClientBandwidthLimitThrottlesBodies(t *testing.T) {
+	body := strings.Repeat("x", 30_000)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer s.Close()
+
+	l := NewBandwidthLimiter()
+	l.SetLimit(100_000, nil)
+	c := NewClient(2*time.Second, RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	c.SetBandwidthLimiter(l)
+	begin := time.Now()
+	status, b, err := c.GetBytes(context.Background(), s.URL, nil)
+	if err != nil || status != 200 || len(b) != len(body) {
+		t.Fatalf("unexpected response: %d %d %v", status, len(b), err)
+	}
+	// 30kB at 100kB/s from an empty bucket takes about 300ms.
+	if elapsed := time.Since(begin); elapsed < 250*time.Millisecond {
+		t.Fatalf("body read was not throttled: %s", elapsed)
+	}
+}
@@ -0,0 +1,194 @@
+package netx
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerOptions configures a CircuitBreaker. Threshold is how many failed
+// requests in a row open a host's circuit, and zero or less never opens it.
+// Cooldown is how long an open circuit fails fast before one probe request
+// may test the host again; it defaults to 30 seconds.
+type BreakerOptions struct {
+	Threshold int
+	Cooldown  time.Duration
+}
+
+// BreakerState is the state of one host's circuit.
+type BreakerState int
+
+const (
+	// BreakerClosed lets requests through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails requests fast until the cooldown ends.
+	BreakerOpen
+	// BreakerHalfOpen lets one probe request through.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitOpenError is returned for requests to a host whose circuit is open.
+type CircuitOpenError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s until %s", e.Host, e.Until.Format("15:04:05"))
+}
+
+// CircuitBreaker stops requests to hosts that keep failing, so one broken
+// host does not absorb the retries of every job. Failures are transport
+// errors, 429 and 5xx responses; any other response closes the circuit. A
+// 429 or 503 Retry-After longer than the cooldown keeps the circuit open
+// that long. A nil breaker lets every request through.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	opts     BreakerOptions
+	hosts    map[string]*breakerHost
+	onChange func(host string, state BreakerState, until time.Time)
+	now      func() time.Time
+}
+
+type breakerHost struct {
+	state    BreakerState
+	failures int
+	until    time.Time
+	// probing is set while the half-open probe request is in flight.
+	probing bool
+}
+
+// NewCircuitBreaker creates a breaker with opts.
+func NewCircuitBreaker(opts BreakerOptions) *CircuitBreaker {
+	b := &CircuitBreaker{hosts: map[string]*breakerHost{}, now: time.Now}
+	b.SetOptions(opts)
+	return b
+}
+
+// SetOptions replaces the options; circuits already open keep their cooldown.
+func (b *CircuitBreaker) SetOptions(opts BreakerOptions) {
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 30 * time.Second
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.opts = opts
+}
+
+// OnStateChange sets fn to be called whenever a host's circuit changes
+// state; until is the end of the cooldown of an open circuit.
+func (b *CircuitBreaker) OnStateChange(fn func(host string, state BreakerState, until time.Time)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onChange = fn
+}
+
+// allow returns a CircuitOpenError when a request to host must fail fast.
+// Otherwise the request's outcome must be passed to record or abort.
+func (b *CircuitBreaker) allow(host string) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	h := b.hostLocked(host)
+	switch {
+	case h.state == BreakerClosed:
+		b.mu.Unlock()
+		return nil
+	case h.state == BreakerOpen && !b.now().Before(h.until):
+		h.state, h.probing = BreakerHalfOpen, true
+		b.mu.Unlock()
+		b.notify(host, BreakerHalfOpen, time.Time{})
+		return nil
+	case h.state == BreakerHalfOpen && !h.probing:
+		h.probing = true
+		b.mu.Unlock()
+		return nil
+	}
+	until := h.until
+	b.mu.Unlock()
+	return &CircuitOpenError{Host: host, Until: until}
+}
+
+// record feeds back the outcome of an allowed request. A failure may carry
+// the delay the server asked for.
+func (b *CircuitBreaker) record(host string, failed bool, wait time.Duration) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	h := b.hostLocked(host)
+	h.probing = false
+	if !failed {
+		h.failures = 0
+		changed := h.state != BreakerClosed
+		h.state = BreakerClosed
+		b.mu.Unlock()
+		if changed {
+			b.notify(host, BreakerClosed, time.Time{})
+		}
+		return
+	}
+	h.failures++
+	if b.opts.Threshold <= 0 || (h.state == BreakerClosed && h.failures < b.opts.Threshold) {
+		b.mu.Unlock()
+		return
+	}
+	// Requests sent before the circuit opened may still fail; they only
+	// extend the cooldown.
+	changed := h.state != BreakerOpen
+	h.state = BreakerOpen
+	h.until = later(h.until, b.now().Add(max(b.opts.Cooldown, wait)))
+	until := h.until
+	b.mu.Unlock()
+	if changed {
+		b.notify(host, BreakerOpen, until)
+	}
+}
+
+// abort forgets an allowed request that ended without an outcome, such as
+// one cancelled by its caller.
+func (b *CircuitBreaker) abort(host string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.hostLocked(host).probing = false
+}
+
+func (b *CircuitBreaker) hostLocked(host string) *breakerHost {
+	h, ok := b.hosts[host]
+	if !ok {
+		h = &breakerHost{}
+		b.hosts[host] = h
+	}
+	return h
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func (b *CircuitBreaker) notify(host string, state BreakerState, until time.Time) {
+	b.mu.Lock()
+	fn := b.onChange
+	b.mu.Unlock()
+	if fn != nil {
+		fn(host, state, until)
+	}
+}
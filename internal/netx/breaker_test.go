@@ -0,0 +1,127 @@
+package netx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensProbesAndCloses(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewCircuitBreaker(BreakerOptions{Threshold: 2, Cooldown: time.Minute})
+	b.now = func() time.Time { return now }
+	var states []BreakerState
+	b.OnStateChange(func(host string, state BreakerState, until time.Time) { states = append(states, state) })
+
+	for range 2 {
+		if err := b.allow("a"); err != nil {
+			t.Fatalf("closed circuit must allow: %v", err)
+		}
+		b.record("a", true, 0)
+	}
+	var open *CircuitOpenError
+	if err := b.allow("a"); !errors.As(err, &open) || !open.Until.Equal(now.Add(time.Minute)) {
+		t.Fatalf("want open circuit until cooldown end, got %v", err)
+	}
+	if err := b.allow("b"); err != nil {
+		t.Fatalf("other hosts must not be affected: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.allow("a"); err != nil {
+		t.Fatalf("want probe after cooldown: %v", err)
+	}
+	if err := b.allow("a"); err == nil {
+		t.Fatal("only one probe may be in flight")
+	}
+	// A failed probe opens the circuit again at once, for the longer
+	// Retry-After.
+	b.record("a", true, 2*time.Minute)
+	if err := b.allow("a"); !errors.As(err, &open) || !open.Until.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("want reopened circuit, got %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := b.allow("a"); err != nil {
+		t.Fatalf("want probe: %v", err)
+	}
+	b.record("a", false, 0)
+	if err := b.allow("a"); err != nil {
+		t.Fatalf("successful probe must close the circuit: %v", err)
+	}
+	want := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if len(states) != len(want) {
+		t.Fatalf("want states %v, got %v", want, states)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("want states %v, got %v", want, states)
+		}
+	}
+}
+
+func TestClientFailsFastWhileCircuitOpen(t *testing.T) {
+	var calls atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	c := NewClient(2*time.Second, RetryOptions{Retries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	c.SetCircuitBreaker(NewCircuitBreaker(BreakerOptions{Threshold: 2, Cooldown: time.Minute}))
+	_, _, err := c.GetBytes(context.Background(), s.URL, nil)
+	var open *CircuitOpenError
+	if !errors.As(err, &open) {
+		t.Fatalf("want circuit open error, got %v", err)
+	}
+	if _, _, err := c.GetBytes(context.Background(), s.URL, nil); !errors.As(err, &open) {
+		t.Fatalf("want fail fast, got %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("want 2 requests before the circuit opened, got %d", n)
+	}
+}
+
+func TestClientHonoursRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	c := NewClient(2*time.Second, RetryOptions{Retries: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	begin := time.Now()
+	status, _, err := c.GetBytes(context.Background(), s.URL, nil)
+	if err != nil || status != 200 {
+		t.Fatalf("unexpected result: %d %v", status, err)
+	}
+	if elapsed := time.Since(begin); elapsed < time.Second {
+		t.Fatalf("retry came after %s, before Retry-After", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"7":                             7 * time.Second,
+		"-3":                            0,
+		"soon":                          0,
+		"Mon, 01 Jan 2024 00:00:30 GMT": 30 * time.Second,
+		"Sun, 31 Dec 2023 23:59:00 GMT": 0,
+	}
+	for in, want := range cases {
+		if got := parseRetryAfter(in, now); got != want {
+			t.Fatalf("%q: want %s, got %s", in, want, got)
+		}
+	}
+}
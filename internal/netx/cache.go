@@ -0,0 +1,187 @@
+package netx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"rajidou/internal/util"
+)
+
+// ResponseCache keeps XML and JSON responses of GetBytes and GetText on
+// disk for requests whose context was marked with WithCache. Within the TTL
+// a cached response is served without a request; after it, the response is
+// revalidated with If-None-Match or If-Modified-Since when the server sent a
+// validator. Unmarked requests, requests carrying credentials, requests sent
+// with Do or GetStream, and any other content type are never cached. A nil
+// or disabled cache stores nothing.
+type ResponseCache struct {
+	mu  sync.Mutex
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// cacheEntry is one cached response as stored on disk.
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	Status       int       `json:"status"`
+	ContentType  string    `json:"contentType"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Stored       time.Time `json:"stored"`
+	Body         []byte    `json:"body"`
+}
+
+// NewResponseCache creates a disabled cache; see SetDir.
+func NewResponseCache() *ResponseCache {
+	return &ResponseCache{now: time.Now}
+}
+
+// SetDir stores responses in dir, serving them without revalidation for
+// ttl. An empty dir disables the cache.
+func (c *ResponseCache) SetDir(dir string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dir, c.ttl = dir, ttl
+}
+
+type cacheKey struct{}
+
+// WithCache returns a copy of ctx that lets GetBytes and GetText answer
+// requests sent with it from the ResponseCache.
+func WithCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheKey{}, true)
+}
+
+// SetResponseCache makes GetBytes and GetText through c use rc. Call it
+// before c is used.
+func (c *Client) SetResponseCache(rc *ResponseCache) {
+	c.cache = rc
+}
+
+// lookup returns the cached response for req, or nil when there is none or
+// req must not be cached.
+func (c *ResponseCache) lookup(req *http.Request) *cacheEntry {
+	path, ok := c.path(req)
+	if !ok {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var e cacheEntry
+	// A hash collision or a damaged file counts as a miss.
+	if err := json.Unmarshal(raw, &e); err != nil || e.URL != req.URL.String() {
+		return nil
+	}
+	return &e
+}
+
+// fresh reports whether e may be served without asking the server.
+func (c *ResponseCache) fresh(e *cacheEntry) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now().Sub(e.Stored) < c.ttl
+}
+
+// revalidate makes req conditional on e still being current, and reports
+// whether e has a validator to check.
+func (e *cacheEntry) revalidate(req *http.Request) bool {
+	if e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+	return e.ETag != "" || e.LastModified != ""
+}
+
+// refresh restarts the TTL of e after the server confirmed it.
+func (c *ResponseCache) refresh(req *http.Request, e *cacheEntry) {
+	path, ok := c.path(req)
+	if !ok {
+		return
+	}
+	e.Stored = c.clock()
+	c.write(path, e)
+}
+
+// store caches a response to req when both may be cached.
+func (c *ResponseCache) store(req *http.Request, status int, header http.Header, body []byte) {
+	path, ok := c.path(req)
+	if !ok || status != http.StatusOK || !cacheableType(header.Get("Content-Type")) ||
+		strings.Contains(strings.ToLower(header.Get("Cache-Control")), "no-store") {
+		return
+	}
+	c.write(path, &cacheEntry{
+		URL:          req.URL.String(),
+		Status:       status,
+		ContentType:  header.Get("Content-Type"),
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Stored:       c.clock(),
+		Body:         body,
+	})
+}
+
+// write saves e at path; failing to cache is not an error.
+func (c *ResponseCache) write(path string, e *cacheEntry) {
+	raw, err := json.Marshal(e)
+	if err != nil || os.MkdirAll(filepath.Dir(path), 0o755) != nil {
+		return
+	}
+	_ = util.WriteFileAtomic(path, raw, 0o644)
+}
+
+func (c *ResponseCache) clock() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now()
+}
+
+// path returns the file caching req, and false when the cache is disabled
+// or req must not be cached.
+func (c *ResponseCache) path(req *http.Request) (string, bool) {
+	if c == nil || req.Context().Value(cacheKey{}) == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	dir := c.dir
+	c.mu.Unlock()
+	if dir == "" || req.Method != http.MethodGet || hasCredentials(req.Header) {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(req.URL.String()))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json"), true
+}
+
+// hasCredentials reports whether h carries cookies or any authorization or
+// auth token header, such as Radiko's X-Radiko-AuthToken.
+func hasCredentials(h http.Header) bool {
+	for k := range h {
+		if k == "Cookie" || strings.Contains(strings.ToLower(k), "auth") {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheableType reports whether a response of content type ct is XML or
+// JSON; media, playlists and pages are never cached.
+func cacheableType(ct string) bool {
+	ct = strings.ToLower(ct)
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.HasSuffix(ct, "/xml") || strings.HasSuffix(ct, "+xml") ||
+		strings.HasSuffix(ct, "/json") || strings.HasSuffix(ct, "+json")
+}
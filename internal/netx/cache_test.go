@@ -0,0 +1,93 @@
+package netx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResponseCacheServesFreshAndRevalidates(t *testing.T) {
+	var calls, conditional atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("<stations/>"))
+	}))
+	defer s.Close()
+
+	now := time.Now()
+	rc := NewResponseCache()
+	rc.SetDir(t.TempDir(), time.Hour)
+	rc.now = func() time.Time { return now }
+	c := NewClient(2*time.Second, RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	c.SetResponseCache(rc)
+
+	ctx := WithCache(context.Background())
+	for i, wantCalls := range []int32{1, 1} {
+		status, body, err := c.GetText(ctx, s.URL, nil)
+		if err != nil || status != 200 || body != "<stations/>" {
+			t.Fatalf("get %d: unexpected result: %d %q %v", i, status, body, err)
+		}
+		if got := calls.Load(); got != wantCalls {
+			t.Fatalf("get %d: want %d requests, got %d", i, wantCalls, got)
+		}
+	}
+
+	now = now.Add(2 * time.Hour)
+	status, body, err := c.GetText(ctx, s.URL, nil)
+	if err != nil || status != 200 || body != "<stations/>" {
+		t.Fatalf("revalidated get: unexpected result: %d %q %v", status, body, err)
+	}
+	if conditional.Load() != 1 {
+		t.Fatal("want a conditional request after the TTL")
+	}
+	// The 304 restarts the TTL.
+	if _, _, err := c.GetText(ctx, s.URL, nil); err != nil || calls.Load() != 2 {
+		t.Fatalf("want the refreshed entry served, got %d requests, %v", calls.Load(), err)
+	}
+}
+
+func TestResponseCacheSkipsMediaCredentialsAndUnmarkedRequests(t *testing.T) {
+	var calls atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/seg.aac" {
+			w.Header().Set("Content-Type", "audio/aac")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		_, _ = w.Write([]byte("x"))
+	}))
+	defer s.Close()
+
+	rc := NewResponseCache()
+	rc.SetDir(t.TempDir(), time.Hour)
+	c := NewClient(2*time.Second, RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	c.SetResponseCache(rc)
+
+	ctx := WithCache(context.Background())
+	auth := map[string]string{"X-Radiko-AuthToken": "secret"}
+	for range 2 {
+		if _, _, err := c.GetBytes(ctx, s.URL+"/seg.aac", nil); err != nil {
+			t.Fatalf("get segment: %v", err)
+		}
+		if _, _, err := c.GetBytes(ctx, s.URL+"/playlist", auth); err != nil {
+			t.Fatalf("get with token: %v", err)
+		}
+		if _, _, err := c.GetBytes(context.Background(), s.URL+"/search", nil); err != nil {
+			t.Fatalf("get unmarked: %v", err)
+		}
+	}
+	if got := calls.Load(); got != 6 {
+		t.Fatalf("want every request sent, got %d", got)
+	}
+}
@@ -2,11 +2,16 @@ package netx
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -14,6 +19,10 @@ import (
 type Client struct {
 	httpClient *http.Client
 	retry      RetryOptions
+	bandwidth  *BandwidthLimiter
+	hosts      *HostLimiter
+	breaker    *CircuitBreaker
+	cache      *ResponseCache
 }
 
 // NewClient builds a Client with a tuned transport and timeout.
@@ -57,55 +66,90 @@ func NewClientWithHTTPClient(httpClient *http.Client, retry RetryOptions) *Clien
 	}
 }
 
+// SetBandwidthLimiter makes every response body read through c draw from l.
+// Clients sharing l share its limit. Call it before c is used.
+func (c *Client) SetBandwidthLimiter(l *BandwidthLimiter) {
+	c.bandwidth = l
+}
+
+// SetHostLimiter makes every request through c wait for its host's limits
+// in l. Call it before c is used.
+func (c *Client) SetHostLimiter(l *HostLimiter) {
+	c.hosts = l
+}
+
+// SetCircuitBreaker makes every request through c fail fast while its
+// host's circuit in b is open. Call it before c is used.
+func (c *Client) SetCircuitBreaker(b *CircuitBreaker) {
+	c.breaker = b
+}
+
 // Do executes req with RetryOperation.
 //
-// Retryable transport errors and HTTP 5xx/429 responses are retried. Errors
-// deemed non-retryable are wrapped as permanentError so RetryOperation stops
-// retrying; callers can unwrap with unwrapPermanent.
+// Failed attempts are retried while the request's RetryClassifier (see
+// WithRetryClassifier) deems them retryable; other errors are wrapped as
+// permanentError so RetryOperation stops retrying, and callers can unwrap
+// with unwrapPermanent. A Retry-After header on a 5xx or 429 response sets
+// the least delay before the next attempt. Each attempt first waits for the
+// host limiter, and holds its slot until the response body is closed;
+// backoffs hold no slot. While the host's circuit is open, attempts fail at
+// once with a CircuitOpenError.
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
-	ctx := req.Context()
-	return RetryOperation(ctx, c.retry, func() (*http.Response, error) {
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
-			if isRetryableError(err) {
-				return nil, err
-			}
-			return nil, &permanentError{err: err}
-		}
-		if resp.StatusCode >= 500 || resp.StatusCode == 429 {
-			_ = resp.Body.Close()
-			return nil, fmt.Errorf("retryable status: %d", resp.StatusCode)
-		}
-		return resp, nil
+	return RetryOperation(req.Context(), c.retry, func() (*http.Response, error) {
+		return c.attempt(req)
 	})
 }
 
-// GetText sends a GET request and returns status code plus UTF-8 text body.
-//
-// Any permanentError from Do is unwrapped before returning.
-func (c *Client) GetText(ctx context.Context, rawURL string, headers map[string]string) (int, string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+// attempt sends req once, returning classified errors for Do.
+func (c *Client) attempt(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	host := req.URL.Hostname()
+	release, err := c.hosts.acquire(ctx, host)
 	if err != nil {
-		return 0, "", err
+		return nil, &permanentError{err: err}
 	}
-	for k, v := range headers {
-		req.Header.Set(k, v)
+	if err := c.breaker.allow(host); err != nil {
+		release()
+		return nil, &permanentError{err: err}
 	}
-	resp, err := c.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return 0, "", unwrapPermanent(err)
+		release()
+		if ctx.Err() != nil {
+			c.breaker.abort(host)
+		} else {
+			c.breaker.record(host, true, 0)
+		}
+		return nil, classify(ctx, err)
 	}
-	defer resp.Body.Close()
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return resp.StatusCode, "", err
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	if resp.StatusCode >= 500 || resp.StatusCode == 429 {
+		_ = resp.Body.Close()
+		wait := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		c.breaker.record(host, true, wait)
+		return nil, classify(ctx, &StatusError{Status: resp.StatusCode, RetryAfter: wait})
 	}
-	return resp.StatusCode, string(b), nil
+	c.breaker.record(host, false, 0)
+	if c.bandwidth != nil {
+		resp.Body = &throttledBody{ReadCloser: resp.Body, ctx: ctx, limiter: c.bandwidth}
+	}
+	return resp, nil
+}
+
+// GetText sends a GET request and returns status code plus UTF-8 text body.
+//
+// Like GetBytes, it retries the request together with the body read.
+func (c *Client) GetText(ctx context.Context, rawURL string, headers map[string]string) (int, string, error) {
+	status, b, err := c.GetBytes(ctx, rawURL, headers)
+	return status, string(b), err
 }
 
 // GetBytes sends a GET request and returns status code plus raw response body.
 //
-// Any permanentError from Do is unwrapped before returning.
+// The request and the read of its body are retried as one unit, so a body
+// cut off halfway is fetched again. With a ResponseCache and a ctx marked
+// by WithCache, cached responses are served or revalidated instead. Any
+// permanentError is unwrapped before returning.
 func (c *Client) GetBytes(ctx context.Context, rawURL string, headers map[string]string) (int, []byte, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 	if err != nil {
@@ -114,16 +158,92 @@ func (c *Client) GetBytes(ctx context.Context, rawURL string, headers map[string
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
-	resp, err := c.Do(req)
-	if err != nil {
-		return 0, nil, unwrapPermanent(err)
+	cached := c.cache.lookup(req)
+	if cached != nil && c.cache.fresh(cached) {
+		return cached.Status, cached.Body, nil
 	}
-	defer resp.Body.Close()
-	b, err := io.ReadAll(resp.Body)
+	conditional := cached != nil && cached.revalidate(req)
+	status := 0
+	var header http.Header
+	b, err := RetryOperation(ctx, c.retry, func() ([]byte, error) {
+		resp, err := c.attempt(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		status, header = resp.StatusCode, resp.Header
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, classify(ctx, err)
+		}
+		return b, nil
+	})
 	if err != nil {
-		return resp.StatusCode, nil, err
+		return status, nil, unwrapPermanent(err)
 	}
-	return resp.StatusCode, b, nil
+	if conditional && status == http.StatusNotModified {
+		c.cache.refresh(req, cached)
+		return cached.Status, cached.Body, nil
+	}
+	c.cache.store(req, status, header, b)
+	return status, b, nil
+}
+
+// StatusError reports a 5xx or 429 response, with the delay its Retry-After
+// header asked for.
+type StatusError struct {
+	Status     int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string             { return fmt.Sprintf("retryable status: %d", e.Status) }
+func (e *StatusError) retryAfter() time.Duration { return e.RetryAfter }
+
+// parseRetryAfter returns the delay a Retry-After header value asks for,
+// given in seconds or as an HTTP date, or zero when there is none.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(0, time.Duration(secs)*time.Second)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(0, t.Sub(now))
+	}
+	return 0
+}
+
+// RetryClassifier reports whether a failed attempt is worth retrying. It
+// sees transport and body read errors, and a *StatusError for 5xx and 429
+// responses.
+type RetryClassifier func(err error) bool
+
+type classifierKey struct{}
+
+// WithRetryClassifier returns a copy of ctx that makes requests sent with it
+// retry the failures classify accepts instead of those IsRetryable accepts.
+func WithRetryClassifier(ctx context.Context, classify RetryClassifier) context.Context {
+	return context.WithValue(ctx, classifierKey{}, classify)
+}
+
+// classify wraps err as permanentError unless it is retryable.
+func classify(ctx context.Context, err error) error {
+	if !retryable(ctx, err) {
+		return &permanentError{err: err}
+	}
+	return err
+}
+
+// retryable applies the request's classifier to err. Nothing is retried once
+// ctx is done.
+func retryable(ctx context.Context, err error) bool {
+	fn := IsRetryable
+	if c, ok := ctx.Value(classifierKey{}).(RetryClassifier); ok && c != nil {
+		fn = c
+	}
+	return ctx.Err() == nil && fn(err)
 }
 
 type permanentError struct{ err error }
@@ -139,13 +259,44 @@ func unwrapPermanent(err error) error {
 	return err
 }
 
-func isRetryableError(err error) bool {
+// IsRetryable is the default RetryClassifier. It retries 5xx and 429
+// responses, timeouts (including url.Error timeouts), connections that were
+// reset, refused or cut off by an unexpected EOF, and temporary DNS
+// failures. Certificate and TLS record errors and anything unrecognised are
+// not retried.
+func IsRetryable(err error) bool {
 	if err == nil {
 		return false
 	}
-	if nerr, ok := err.(net.Error); ok {
-		return nerr.Timeout() || nerr.Temporary()
+	var status *StatusError
+	if errors.As(err, &status) {
+		return true
+	}
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &certErr) || errors.As(err, &recordErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	for _, errno := range []syscall.Errno{syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED,
+		syscall.EPIPE, syscall.ETIMEDOUT, syscall.EHOSTUNREACH, syscall.ENETUNREACH} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout() || netErr.Temporary()
 	}
-	s := strings.ToLower(err.Error())
-	return strings.Contains(s, "connection reset") || strings.Contains(s, "timeout") || strings.Contains(s, "eof")
+	return false
 }
@@ -2,13 +2,19 @@ package netx
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -75,12 +81,18 @@ func TestUnwrapPermanent(t *testing.T) {
 	}
 }
 
-func TestIsRetryableError(t *testing.T) {
-	if !isRetryableError(errors.New("connection reset by peer")) {
-		t.Fatal("expected retryable")
+func TestIsRetryable(t *testing.T) {
+	reset := &url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}
+	for _, err := range []error{reset, fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), &StatusError{Status: 503}, &net.DNSError{IsTimeout: true}} {
+		if !IsRetryable(err) {
+			t.Fatalf("expected retryable: %v", err)
+		}
 	}
-	if isRetryableError(errors.New("permission denied")) {
-		t.Fatal("expected non-retryable")
+	cert := &url.Error{Op: "Get", URL: "https://example.com", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}
+	for _, err := range []error{errors.New("connection reset by peer"), errors.New("permission denied"), cert, &net.DNSError{IsNotFound: true}} {
+		if IsRetryable(err) {
+			t.Fatalf("expected non-retryable: %v", err)
+		}
 	}
 }
 
@@ -175,7 +187,53 @@ func TestClientGetBytesSuccess(t *testing.T) {
 
 func TestIsRetryableErrorWithNetTemporary(t *testing.T) {
 	var _ net.Error = tempErr{}
-	if !isRetryableError(tempErr{}) {
+	if !IsRetryable(tempErr{}) {
 		t.Fatal("temporary net error should be retryable")
 	}
 }
+
+func TestClientGetBytesRetriesTruncatedBody(t *testing.T) {
+	var calls int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4")
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// Close the connection halfway through the body.
+			_, _ = w.Write([]byte("ok"))
+			return
+		}
+		_, _ = w.Write([]byte("okok"))
+	}))
+	defer s.Close()
+
+	c := NewClient(2*time.Second, RetryOptions{Retries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	status, b, err := c.GetBytes(context.Background(), s.URL, nil)
+	if err != nil || status != 200 || string(b) != "okok" {
+		t.Fatalf("unexpected result: %d %q %v", status, b, err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("want 2 calls, got %d", got)
+	}
+}
+
+func TestClientUsesRequestClassifier(t *testing.T) {
+	var calls int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer s.Close()
+
+	c := NewClient(2*time.Second, RetryOptions{Retries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	ctx := WithRetryClassifier(context.Background(), func(err error) bool {
+		var se *StatusError
+		return !errors.As(err, &se) && IsRetryable(err)
+	})
+	_, _, err := c.GetBytes(ctx, s.URL, nil)
+	var se *StatusError
+	if !errors.As(err, &se) || se.Status != http.StatusBadGateway {
+		t.Fatalf("want status error, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("classifier must stop retries, got %d calls", got)
+	}
+}
@@ -0,0 +1,145 @@
+package netx
+
+import (
+	"context"
+	"io"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostLimit caps the requests a Client sends to one host. Concurrency bounds
+// requests in flight, counted until the response body is closed, and
+// Interval is the minimum time between request starts. Zero values disable
+// each cap.
+type HostLimit struct {
+	Concurrency int
+	Interval    time.Duration
+}
+
+// DefaultHostLimits returns the limits applied to Radiko's own hosts unless
+// configured otherwise. The segment CDN is left to the fetch pool.
+func DefaultHostLimits() map[string]HostLimit {
+	return map[string]HostLimit{
+		"radiko.jp":   {Concurrency: 4, Interval: 20 * time.Millisecond},
+		"*.radiko.jp": {Concurrency: 4, Interval: 20 * time.Millisecond},
+	}
+}
+
+// HostLimiter enforces HostLimits per host. Limits are keyed by exact host
+// name, by "*.domain" for any subdomain, or by "*" for every other host;
+// the most specific key wins. Each host matched by a wildcard is limited on
+// its own. A nil limiter never blocks.
+type HostLimiter struct {
+	mu     sync.Mutex
+	limits map[string]HostLimit
+	hosts  map[string]*hostState
+}
+
+type hostState struct {
+	active int
+	// next is the earliest start of the following request.
+	next time.Time
+	// wake is closed and replaced when a request finishes.
+	wake chan struct{}
+}
+
+// NewHostLimiter creates a limiter enforcing limits.
+func NewHostLimiter(limits map[string]HostLimit) *HostLimiter {
+	return &HostLimiter{limits: maps.Clone(limits), hosts: map[string]*hostState{}}
+}
+
+// SetLimits replaces the limits; requests already in flight keep counting.
+func (l *HostLimiter) SetLimits(limits map[string]HostLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = maps.Clone(limits)
+}
+
+func (l *HostLimiter) limitLocked(host string) HostLimit {
+	if lim, ok := l.limits[host]; ok {
+		return lim
+	}
+	for h := host; ; {
+		i := strings.IndexByte(h, '.')
+		if i < 0 {
+			break
+		}
+		h = h[i+1:]
+		if lim, ok := l.limits["*."+h]; ok {
+			return lim
+		}
+	}
+	return l.limits["*"]
+}
+
+// acquire waits until host has room for another request, or ctx is done.
+// On success the returned release must be called once the request is over.
+func (l *HostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	for {
+		l.mu.Lock()
+		lim := l.limitLocked(host)
+		st, ok := l.hosts[host]
+		if !ok {
+			st = &hostState{wake: make(chan struct{})}
+			l.hosts[host] = st
+		}
+		var wait <-chan struct{}
+		var delay time.Duration
+		now := time.Now()
+		switch {
+		case lim.Concurrency > 0 && st.active >= lim.Concurrency:
+			wait = st.wake
+		case now.Before(st.next):
+			delay = st.next.Sub(now)
+		default:
+			st.active++
+			if lim.Interval > 0 {
+				st.next = now.Add(lim.Interval)
+			}
+			l.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(func() { l.release(st) }) }, nil
+		}
+		l.mu.Unlock()
+		if wait == nil {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (l *HostLimiter) release(st *hostState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st.active--
+	close(st.wake)
+	st.wake = make(chan struct{})
+}
+
+// releasingBody ends a host limiter slot when the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,87 @@
+package netx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterMatchesMostSpecificKey(t *testing.T) {
+	l := NewHostLimiter(map[string]HostLimit{
+		"api.radiko.jp": {Concurrency: 1},
+		"*.radiko.jp":   {Concurrency: 2},
+		"*":             {Concurrency: 3},
+	})
+	for host, want := range map[string]int{"api.radiko.jp": 1, "a.b.radiko.jp": 2, "example.com": 3} {
+		if got := l.limitLocked(host).Concurrency; got != want {
+			t.Fatalf("%s: want %d, got %d", host, want, got)
+		}
+	}
+}
+
+func TestClientHostLimitCapsConcurrencyAndInterval(t *testing.T) {
+	var active, peak atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		active.Add(-1)
+	}))
+	defer s.Close()
+
+	c := NewClient(2*time.Second, RetryOptions{Retries: 1, BaseDelay: time.Millisecond})
+	c.SetHostLimiter(NewHostLimiter(map[string]HostLimit{"*": {Concurrency: 2, Interval: 20 * time.Millisecond}}))
+	begin := time.Now()
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := c.GetBytes(context.Background(), s.URL, nil); err != nil {
+				t.Errorf("get: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if p := peak.Load(); p > 2 {
+		t.Fatalf("want at most 2 requests in flight, saw %d", p)
+	}
+	// Six starts 20ms apart span at least 100ms.
+	if elapsed := time.Since(begin); elapsed < 100*time.Millisecond {
+		t.Fatalf("requests were not spaced: %s", elapsed)
+	}
+}
+
+func TestHostLimiterWaitHonoursContext(t *testing.T) {
+	l := NewHostLimiter(map[string]HostLimit{"*": {Concurrency: 1}})
+	release, err := l.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "a"); err == nil {
+		t.Fatal("waiting request must give up with its context")
+	}
+	if r, err := l.acquire(context.Background(), "b"); err != nil {
+		t.Fatalf("other hosts must not wait: %v", err)
+	} else {
+		r()
+	}
+	release()
+	release()
+	if r, err := l.acquire(context.Background(), "a"); err != nil {
+		t.Fatalf("released slot must be reusable: %v", err)
+	} else {
+		r()
+	}
+}
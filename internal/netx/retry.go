@@ -2,6 +2,7 @@ package netx
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"time"
@@ -31,14 +32,24 @@ func (o RetryOptions) withDefaults() RetryOptions {
 	return o
 }
 
+// maxRetryAfter is the longest server-requested delay RetryOperation waits;
+// a longer one ends the retries at once.
+const maxRetryAfter = 2 * time.Minute
+
+// retryDelayer is implemented by errors carrying a server-requested delay,
+// such as a Retry-After header.
+type retryDelayer interface {
+	retryAfter() time.Duration
+}
+
 // RetryOperation executes fn until success, context cancellation, or retries are
 // exhausted.
 //
 // It applies RetryOptions defaults for zero/negative values, uses exponential
-// backoff with jitter between attempts, and returns the last error from fn when
-// retries are exhausted. Callers that need non-retryable failures should wrap
-// such errors in a sentinel type and unwrap at boundaries (see client.go's
-// permanentError pattern).
+// backoff with jitter between attempts, waits longer when an error asks for
+// it through retryDelayer, and returns the last error from fn when
+// retries are exhausted. A permanentError from fn ends the retries at once;
+// callers unwrap it at their boundaries (see client.go).
 func RetryOperation[T interface{}](ctx context.Context, opts RetryOptions, fn func() (T, error)) (T, error) {
 	opts = opts.withDefaults()
 	var zero T
@@ -53,11 +64,20 @@ func RetryOperation[T interface{}](ctx context.Context, opts RetryOptions, fn fu
 			return v, nil
 		}
 		lastErr = err
-		if attempt >= opts.Retries {
+		var perm *permanentError
+		if attempt >= opts.Retries || errors.As(err, &perm) {
 			break
 		}
 
 		delay := backoffWithJitter(opts, attempt)
+		var rd retryDelayer
+		if errors.As(err, &rd) {
+			wait := rd.retryAfter()
+			if wait > maxRetryAfter {
+				break
+			}
+			delay = max(delay, wait)
+		}
 		timer := time.NewTimer(delay)
 		select {
 		case <-ctx.Done():
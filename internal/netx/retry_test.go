@@ -83,3 +83,30 @@ func TestBackoffWithJitterCapsAtMaxDelay(t *testing.T) {
 		t.Fatalf("delay too large: %s", d)
 	}
 }
+
+type delayedErr time.Duration
+
+func (e delayedErr) Error() string             { return "busy" }
+func (e delayedErr) retryAfter() time.Duration { return time.Duration(e) }
+
+func TestRetryOperationGivesUpOnLongRetryAfter(t *testing.T) {
+	attempts := 0
+	_, err := RetryOperation(context.Background(), RetryOptions{Retries: 3, BaseDelay: time.Millisecond}, func() (string, error) {
+		attempts++
+		return "", delayedErr(time.Hour)
+	})
+	if err == nil || attempts != 1 {
+		t.Fatalf("want one attempt and an error, got %d attempts, %v", attempts, err)
+	}
+}
+
+func TestRetryOperationStopsOnPermanentError(t *testing.T) {
+	attempts := 0
+	_, err := RetryOperation(context.Background(), RetryOptions{Retries: 3, BaseDelay: time.Millisecond}, func() (string, error) {
+		attempts++
+		return "", &permanentError{err: errors.New("bad request")}
+	})
+	if err == nil || attempts != 1 {
+		t.Fatalf("want one attempt and an error, got %d attempts, %v", attempts, err)
+	}
+}
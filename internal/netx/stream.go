@@ -0,0 +1,142 @@
+package netx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Stream is a response body read straight from the connection. When the
+// connection fails partway, Stream asks the server for the rest with a
+// byte-range request and carries on, so readers only see the failure once
+// resuming is impossible or keeps failing. A Stream is not safe for
+// concurrent reads, but Received may be called from any goroutine.
+type Stream struct {
+	c   *Client
+	ctx context.Context
+	req *http.Request
+	// ContentLength is the length of the whole body, or -1 when unknown.
+	ContentLength int64
+
+	body      io.ReadCloser
+	received  atomic.Int64
+	resumable bool
+	// validator pins resumes to the same content through If-Range.
+	validator string
+	// resumes counts resumes since the last byte was received.
+	resumes int
+	err     error
+}
+
+// GetStream sends a GET request and returns status code plus the response
+// body as a Stream, which the caller must close.
+//
+// Connecting is retried like GetBytes. Only complete 200 responses resume
+// after a failure, at most the client's retry count of times in a row, and
+// only while the server keeps answering with the rest of the same content.
+// Unless headers set Accept-Encoding, the body is requested without
+// compression so byte offsets stay valid.
+func (c *Client) GetStream(ctx context.Context, rawURL string, headers map[string]string) (int, *Stream, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, nil, unwrapPermanent(err)
+	}
+	s := &Stream{c: c, ctx: ctx, req: req, ContentLength: resp.ContentLength, body: resp.Body}
+	s.resumable = resp.StatusCode == http.StatusOK && req.Header.Get("Range") == "" &&
+		resp.Header.Get("Accept-Ranges") != "none"
+	// If-Range only accepts a strong ETag.
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		s.validator = etag
+	} else {
+		s.validator = resp.Header.Get("Last-Modified")
+	}
+	return resp.StatusCode, s, nil
+}
+
+// Received returns the number of body bytes read so far.
+func (s *Stream) Received() int64 {
+	return s.received.Load()
+}
+
+func (s *Stream) Read(p []byte) (int, error) {
+	for {
+		if s.err != nil {
+			return 0, s.err
+		}
+		n, err := s.body.Read(p)
+		if n > 0 {
+			s.received.Add(int64(n))
+			s.resumes = 0
+		}
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			// The failure comes back on the next read.
+			return n, nil
+		}
+		if err := s.resume(err); err != nil {
+			s.err = err
+		}
+	}
+}
+
+// Close closes the current response body.
+func (s *Stream) Close() error {
+	if s.err == nil {
+		s.err = errors.New("read on closed stream")
+	}
+	return s.body.Close()
+}
+
+// resume replaces the failed body with the rest of the content, or returns
+// the error to report.
+func (s *Stream) resume(cause error) error {
+	opts := s.c.retry.withDefaults()
+	if !s.resumable || s.resumes >= opts.Retries || !retryable(s.ctx, cause) {
+		return cause
+	}
+	_ = s.body.Close()
+	timer := time.NewTimer(backoffWithJitter(opts, s.resumes))
+	select {
+	case <-s.ctx.Done():
+		timer.Stop()
+		return s.ctx.Err()
+	case <-timer.C:
+	}
+	s.resumes++
+
+	offset := s.received.Load()
+	req := s.req.Clone(s.ctx)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	if s.validator != "" {
+		req.Header.Set("If-Range", s.validator)
+	}
+	resp, err := s.c.Do(req)
+	if err != nil {
+		return fmt.Errorf("resume at byte %d: %w (after %w)", offset, unwrapPermanent(err), cause)
+	}
+	if resp.StatusCode != http.StatusPartialContent ||
+		!strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+		// A 200 means the content changed or ranges are unsupported.
+		_ = resp.Body.Close()
+		return fmt.Errorf("resume at byte %d: server answered %d (after %w)", offset, resp.StatusCode, cause)
+	}
+	s.body = resp.Body
+	return nil
+}
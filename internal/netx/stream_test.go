@@ -0,0 +1,79 @@
+package netx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyContent serves content, cutting off the first full response after
+// cut bytes. When ignoreRange is set it answers range requests with 200.
+func flakyContent(t *testing.T, content string, cut int, ignoreRange bool) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		if rg := r.Header.Get("Range"); rg != "" && !ignoreRange {
+			var from int
+			if _, err := fmt.Sscanf(rg, "bytes=%d-", &from); err != nil || r.Header.Get("If-Range") != `"v1"` {
+				t.Errorf("unexpected resume headers: %q %q", rg, r.Header.Get("If-Range"))
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", from, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = io.WriteString(w, content[from:])
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		if n == 1 {
+			_, _ = io.WriteString(w, content[:cut])
+			return
+		}
+		_, _ = io.WriteString(w, content)
+	}))
+	t.Cleanup(s.Close)
+	return s, &calls
+}
+
+func TestGetStreamResumesAfterCutOff(t *testing.T) {
+	s, calls := flakyContent(t, "0123456789", 4, false)
+	c := NewClient(2*time.Second, RetryOptions{Retries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	status, st, err := c.GetStream(context.Background(), s.URL, nil)
+	if err != nil || status != 200 {
+		t.Fatalf("unexpected result: %d %v", status, err)
+	}
+	defer st.Close()
+	b, err := io.ReadAll(st)
+	if err != nil || string(b) != "0123456789" {
+		t.Fatalf("want whole content, got %q %v", b, err)
+	}
+	if st.Received() != 10 || st.ContentLength != 10 {
+		t.Fatalf("want 10 bytes counted of 10, got %d of %d", st.Received(), st.ContentLength)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("want 2 requests, got %d", n)
+	}
+}
+
+func TestGetStreamFailsWhenServerIgnoresRange(t *testing.T) {
+	s, _ := flakyContent(t, "0123456789", 4, true)
+	c := NewClient(2*time.Second, RetryOptions{Retries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	_, st, err := c.GetStream(context.Background(), s.URL, nil)
+	if err != nil {
+		t.Fatalf("get stream: %v", err)
+	}
+	defer st.Close()
+	b, err := io.ReadAll(st)
+	if err == nil || !strings.Contains(err.Error(), "server answered 200") {
+		t.Fatalf("want resume error, got %v", err)
+	}
+	if string(b) != "0123" {
+		t.Fatalf("want the bytes before the cut, got %q", b)
+	}
+}
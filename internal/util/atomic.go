@@ -0,0 +1,39 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Source map in this file:
+// - atomic replace-on-write is a CLI utility with no Rajiko counterpart.
+// WriteFileAtomic writes data to a temporary file in the target directory,
+// syncs it, and renames it over path.
+//
+// Readers therefore observe either the previous file or the complete new one,
+// never a partially written file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	// Remove the temp file on every failure path; after rename this is a no-op.
+	defer os.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
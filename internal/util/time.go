@@ -10,23 +10,28 @@ import (
 // - Parse/Format helpers are CLI utilities.
 const tsLayout = "20060102150405"
 
-// ParseTimestamp parses a local-time timestamp in "YYYYMMDDHHMMSS" format.
+// Tokyo is Japan Standard Time, the zone of every Radiko timestamp. Japan has
+// no daylight saving time, so a fixed zone needs no tzdata on the host.
+var Tokyo = time.FixedZone("JST", 9*60*60)
+
+// ParseTimestamp parses a Radiko timestamp in "YYYYMMDDHHMMSS" format.
 //
-// Input must be exactly 14 digits and is interpreted in time.Local.
+// Input must be exactly 14 digits and is interpreted in Tokyo time, whatever
+// the host's zone.
 func ParseTimestamp(ts string) (time.Time, error) {
 	if len(ts) != 14 {
 		return time.Time{}, fmt.Errorf("invalid timestamp: %s", ts)
 	}
-	t, err := time.ParseInLocation(tsLayout, ts, time.Local)
+	t, err := time.ParseInLocation(tsLayout, ts, Tokyo)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("invalid timestamp: %s", ts)
 	}
 	return t, nil
 }
 
-// FormatTimestamp formats t as "YYYYMMDDHHMMSS".
+// FormatTimestamp formats t as a "YYYYMMDDHHMMSS" Tokyo time.
 func FormatTimestamp(t time.Time) string {
-	return t.Format(tsLayout)
+	return t.In(Tokyo).Format(tsLayout)
 }
 
 // StepTimestamp shifts a "YYYYMMDDHHMMSS" timestamp by seconds and returns the
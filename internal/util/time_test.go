@@ -25,8 +25,24 @@ func TestParseTimestampErrors(t *testing.T) {
 }
 
 func TestFormatTimestamp(t *testing.T) {
-	got := FormatTimestamp(time.Date(2026, 2, 19, 12, 34, 56, 0, time.Local))
+	got := FormatTimestamp(time.Date(2026, 2, 19, 12, 34, 56, 0, Tokyo))
 	if got != "20260219123456" {
 		t.Fatalf("want 20260219123456, got %s", got)
 	}
 }
+
+func TestTimestampsAreTokyoTimeOnAnyHost(t *testing.T) {
+	old := time.Local
+	time.Local = time.FixedZone("EST", -5*3600)
+	defer func() { time.Local = old }()
+	got, err := ParseTimestamp("20260101000000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := time.Date(2025, 12, 31, 15, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+	if s := FormatTimestamp(time.Date(2025, 12, 31, 15, 0, 0, 0, time.UTC)); s != "20260101000000" {
+		t.Fatalf("want 20260101000000, got %s", s)
+	}
+}